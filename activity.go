@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/billbatista/acasinha-expenses/eventlogger"
+	"github.com/billbatista/acasinha-expenses/ledger"
+	"github.com/billbatista/acasinha-expenses/user"
+	"github.com/google/uuid"
+)
+
+const (
+	activityPageSize      = 20
+	dashboardActivitySize = 5
+)
+
+type ActivityView struct {
+	Text      string
+	CreatedAt time.Time
+	Unread    bool
+}
+
+type LedgerActivityData struct {
+	Ledger   *ledger.Ledger
+	Activity []ActivityView
+	NextURL  string
+}
+
+// ledgerActivity loads a page of the ledger's feed, newest first, marking
+// what others did since the user last looked, and then records it as seen.
+// What was seen goes by when events were recorded rather than created, so
+// one relayed late still shows up as new.
+func ledgerActivity(ctx context.Context, events eventlogger.EventQuerier, ledgerRepo ledger.Repository, ledgerID, userID uuid.UUID, names map[uuid.UUID]string, cursor string, limit int) ([]ActivityView, string, error) {
+	readAt, err := ledgerRepo.GetActivityReadAt(ctx, ledgerID.String(), userID.String())
+	if err != nil {
+		return nil, "", err
+	}
+
+	page, err := events.Query(ctx, eventlogger.Filter{
+		Types:    ledger.ActivityTypes,
+		LedgerID: ledgerID,
+		Limit:    limit,
+		Cursor:   cursor,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	views := make([]ActivityView, 0, len(page.Events))
+	var seenUntil time.Time
+	for _, e := range page.Events {
+		actor, _ := actorOf(e.Event)
+		views = append(views, ActivityView{
+			Text:      describeActivity(e.Event, names),
+			CreatedAt: e.CreatedAt,
+			Unread:    e.RecordedAt.After(readAt) && actor != userID,
+		})
+		if e.RecordedAt.After(seenUntil) {
+			seenUntil = e.RecordedAt
+		}
+	}
+
+	if len(page.Events) > 0 {
+		if err := ledgerRepo.MarkActivityRead(ctx, ledgerID.String(), userID.String(), seenUntil); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return views, page.NextCursor, nil
+}
+
+// describeActivity renders an event as a sentence such as
+// "Ana adicionou 'Supermercado' R$ 230.00"
+func describeActivity(e eventlogger.Event, names map[uuid.UUID]string) string {
+	name := func(id uuid.UUID) string {
+		if n, ok := names[id]; ok {
+			return n
+		}
+		return "Alguém"
+	}
+
+	payload, err := eventlogger.DecodePayload(e)
+	if err != nil {
+		return e.Type
+	}
+
+	switch p := payload.(type) {
+	case *eventlogger.LedgerCreated:
+		return fmt.Sprintf("%s criou o livro '%s'", name(p.UserID), p.Name)
+	case *eventlogger.LedgerMemberAdded:
+		return fmt.Sprintf("%s entrou no livro", name(p.UserID))
+	case *eventlogger.ExpenseCreated:
+		actor, ok := actorOf(e)
+		if !ok || actor == p.PaidBy {
+			return fmt.Sprintf("%s adicionou '%s' %s", name(p.PaidBy), p.Description, formatCurrency(p.Amount))
+		}
+		return fmt.Sprintf("%s adicionou '%s' %s, pago por %s", name(actor), p.Description, formatCurrency(p.Amount), name(p.PaidBy))
+	case *eventlogger.SettlementCreated:
+		return fmt.Sprintf("%s pagou %s para %s", name(p.FromUser), formatCurrency(p.Amount), name(p.ToUser))
+	default:
+		return e.Type
+	}
+}
+
+// actorOf is the user whose request caused the event
+func actorOf(e eventlogger.Event) (uuid.UUID, bool) {
+	id, err := uuid.Parse(e.Metadata[eventlogger.MetadataUserID])
+	return id, err == nil
+}
+
+// ledgerMemberNames maps each member to their name, or email when they haven't set one
+func ledgerMemberNames(ctx context.Context, ledgerRepo ledger.Repository, userRepo user.Repository, ledgerID string) (map[uuid.UUID]string, error) {
+	members, err := ledgerRepo.GetLedgerMembers(ctx, ledgerID)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[uuid.UUID]string, len(members))
+	for _, member := range members {
+		u, err := userRepo.GetByID(ctx, member.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if u == nil {
+			continue
+		}
+		if u.Name != "" {
+			names[member.UserID] = u.Name
+		} else {
+			names[member.UserID] = u.Email
+		}
+	}
+
+	return names, nil
+}
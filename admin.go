@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/billbatista/acasinha-expenses/eventlogger"
+	"github.com/billbatista/acasinha-expenses/middleware"
+	"github.com/billbatista/acasinha-expenses/settings"
+	"github.com/billbatista/acasinha-expenses/user"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	adminEventsPageSize = 50
+	// datetimeLocalLayout is the format of <input type="datetime-local">
+	datetimeLocalLayout = "2006-01-02T15:04"
+	tailPollInterval    = 2 * time.Second
+	// tailSettle is how long an event may take to commit after it was recorded
+	tailSettle = 10 * time.Second
+)
+
+type AdminEventsData struct {
+	Events  []eventlogger.RecordedEvent
+	Counts  []eventlogger.TypeCount
+	Types   string
+	User    string
+	From    string
+	To      string
+	NextURL string
+	TailURL string
+	Error   string
+}
+
+type AdminEventData struct {
+	Event    *eventlogger.Event
+	Data     string
+	Metadata string
+}
+
+type AdminSecurityData struct {
+	TwoFactorRequired bool
+	Success           string
+}
+
+// adminRoutes serves the event viewer and security settings, only
+// reachable by admins
+func adminRoutes(userRepo user.Repository, events eventlogger.EventQuerier, settingsRepo settings.Repository, worker *eventlogger.Worker) func(chi.Router) {
+	return func(r chi.Router) {
+		r.Use(middleware.RequireAuth("/"))
+		r.Use(middleware.RequireAdmin(userRepo))
+		r.Use(middleware.RequireTwoFactor(userRepo, settingsRepo, "/user/two-factor"))
+
+		// runtime and event worker counters published through expvar
+		r.Handle("/debug/vars", expvar.Handler())
+
+		r.Get("/events", func(w http.ResponseWriter, r *http.Request) {
+			data := AdminEventsData{
+				Types: r.URL.Query().Get("type"),
+				User:  r.URL.Query().Get("user"),
+				From:  r.URL.Query().Get("from"),
+				To:    r.URL.Query().Get("to"),
+			}
+
+			filter, err := parseEventFilter(r, userRepo)
+			if err != nil {
+				data.Error = err.Error()
+			} else {
+				filter.Limit = adminEventsPageSize
+				filter.Cursor = r.URL.Query().Get("cursor")
+
+				page, err := events.Query(r.Context(), filter)
+				if err != nil && err != eventlogger.ErrInvalidCursor {
+					slog.Error("failed to query events", "error", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+				if err == eventlogger.ErrInvalidCursor {
+					data.Error = err.Error()
+				}
+
+				counts, err := events.CountByType(r.Context(), filter)
+				if err != nil {
+					slog.Error("failed to count events", "error", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+
+				data.Events = page.Events
+				data.Counts = counts
+
+				query := r.URL.Query()
+				query.Del("cursor")
+				data.TailURL = "/admin/events/tail?" + query.Encode()
+				if page.NextCursor != "" {
+					query.Set("cursor", page.NextCursor)
+					data.NextURL = "/admin/events?" + query.Encode()
+				}
+			}
+
+			tmpl, err := parseTemplates(r, "templates/base.html", "templates/admin-events.html")
+			if err != nil {
+				slog.Error("failed to parse template", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			tmpl.ExecuteTemplate(w, "base.html", data)
+		})
+
+		// tail streams new events matching the filters as server-sent events
+		r.Get("/events/tail", func(w http.ResponseWriter, r *http.Request) {
+			filter, err := parseEventFilter(r, userRepo)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			w.Header().Set("content-type", "text/event-stream")
+			w.Header().Set("cache-control", "no-cache")
+			rc := http.NewResponseController(w)
+
+			// Events are followed in the order they were recorded, the worker
+			// and the outbox relay save them late. Each poll reads the last
+			// tailSettle again since a transaction may commit an event recorded
+			// there after it was read; seen drops the ones already sent.
+			started := time.Now().UTC()
+			newest := started
+			seen := map[uuid.UUID]time.Time{}
+			filter.Limit = 100
+			ticker := time.NewTicker(tailPollInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-r.Context().Done():
+					return
+				case <-ticker.C:
+				}
+
+				after := eventlogger.Position{RecordedAt: newest.Add(-tailSettle)}
+				for {
+					batch, err := events.QueryRecorded(r.Context(), filter, after)
+					if err != nil {
+						slog.Error("failed to tail events", "error", err)
+						return
+					}
+
+					for _, e := range batch {
+						after = e.Position()
+						if _, ok := seen[e.ID]; ok || e.RecordedAt.Before(started) {
+							continue
+						}
+						seen[e.ID] = e.RecordedAt
+						if e.RecordedAt.After(newest) {
+							newest = e.RecordedAt
+						}
+
+						payload, err := json.Marshal(e.Event)
+						if err != nil {
+							slog.Error("failed to encode event", "error", err)
+							continue
+						}
+						fmt.Fprintf(w, "data: %s\n\n", payload)
+					}
+
+					if len(batch) < filter.Limit {
+						break
+					}
+				}
+
+				for id, recordedAt := range seen {
+					if recordedAt.Before(newest.Add(-tailSettle)) {
+						delete(seen, id)
+					}
+				}
+
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			}
+		})
+
+		r.Get("/events/{eventID}", func(w http.ResponseWriter, r *http.Request) {
+			eventID, err := uuid.Parse(chi.URLParam(r, "eventID"))
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+
+			event, err := events.GetByID(r.Context(), eventID)
+			if err != nil {
+				slog.Error("failed to get event", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if event == nil {
+				http.NotFound(w, r)
+				return
+			}
+
+			eventData, err := json.MarshalIndent(event.Data, "", "  ")
+			if err != nil {
+				slog.Error("failed to encode event data", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			eventMetadata, err := json.MarshalIndent(event.Metadata, "", "  ")
+			if err != nil {
+				slog.Error("failed to encode event metadata", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			tmpl, err := parseTemplates(r, "templates/base.html", "templates/admin-event.html")
+			if err != nil {
+				slog.Error("failed to parse template", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			tmpl.ExecuteTemplate(w, "base.html", AdminEventData{
+				Event:    event,
+				Data:     string(eventData),
+				Metadata: string(eventMetadata),
+			})
+		})
+
+		r.Get("/security", func(w http.ResponseWriter, r *http.Request) {
+			required, err := settingsRepo.Bool(r.Context(), settings.TwoFactorRequired)
+			if err != nil {
+				slog.Error("failed to read two-factor setting", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			tmpl, err := parseTemplates(r, "templates/base.html", "templates/admin-security.html")
+			if err != nil {
+				slog.Error("failed to parse template", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			tmpl.ExecuteTemplate(w, "base.html", AdminSecurityData{
+				TwoFactorRequired: required,
+				Success:           r.URL.Query().Get("success"),
+			})
+		})
+
+		r.Post("/security", func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := middleware.GetUserID(r.Context())
+
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+
+			required := r.FormValue("two_factor_required") == "on"
+			if err := settingsRepo.SetBool(r.Context(), settings.TwoFactorRequired, required, userID); err != nil {
+				slog.Error("failed to save two-factor setting", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			evt := eventlogger.NewEventContext(r.Context(),
+				eventlogger.WithPayload(eventlogger.SettingChanged{
+					UserID: userID,
+					Key:    settings.TwoFactorRequired,
+					Value:  strconv.FormatBool(required),
+				}),
+			)
+			worker.Log(evt)
+
+			http.Redirect(w, r, "/admin/security?success="+url.QueryEscape("Configurações salvas"), http.StatusSeeOther)
+		})
+	}
+}
+
+// parseEventFilter reads the viewer filters from the query string. The user
+// filter takes either a user ID or an email address.
+func parseEventFilter(r *http.Request, userRepo user.Repository) (eventlogger.Filter, error) {
+	var filter eventlogger.Filter
+	query := r.URL.Query()
+
+	for t := range strings.SplitSeq(query.Get("type"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			filter.Types = append(filter.Types, t)
+		}
+	}
+
+	if u := strings.TrimSpace(query.Get("user")); u != "" {
+		if id, err := uuid.Parse(u); err == nil {
+			filter.UserID = id
+		} else {
+			found, err := userRepo.GetByEmail(r.Context(), u)
+			if err != nil {
+				return filter, err
+			}
+			if found == nil {
+				return filter, fmt.Errorf("no user with email %s", u)
+			}
+			filter.UserID = found.ID
+		}
+	}
+
+	var err error
+	if filter.From, err = parseDatetimeLocal(query, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseDatetimeLocal(query, "to"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+func parseDatetimeLocal(query url.Values, key string) (time.Time, error) {
+	v := query.Get(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.ParseInLocation(datetimeLocalLayout, v, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s date", key)
+	}
+	return t, nil
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/billbatista/acasinha-expenses/middleware"
+	"github.com/billbatista/acasinha-expenses/user"
+)
+
+func (h *Handler) listActivity(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	page, err := parsePagination(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	activity, err := h.users.GetActivity(r.Context(), userID, page.Limit, page.Offset)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if activity == nil {
+		activity = []user.Activity{}
+	}
+
+	writeJSON(w, http.StatusOK, listResponse{Data: activity, Pagination: page})
+}
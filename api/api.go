@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/billbatista/acasinha-expenses/ledger"
+	"github.com/billbatista/acasinha-expenses/middleware"
+	"github.com/billbatista/acasinha-expenses/token"
+	"github.com/billbatista/acasinha-expenses/user"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultLimit = 10
+	maxLimit     = 100
+)
+
+type contextKey string
+
+const ledgerKey contextKey = "ledger"
+
+type Handler struct {
+	ledgers ledger.Repository
+	users   user.Repository
+}
+
+func NewHandler(ledgers ledger.Repository, users user.Repository) *Handler {
+	return &Handler{
+		ledgers: ledgers,
+		users:   users,
+	}
+}
+
+// Routes returns the v1 router, meant to be mounted under /api/v1
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(requireUser)
+	r.Use(requireScope)
+
+	r.Get("/activity", h.listActivity)
+	r.Get("/ledgers", h.listLedgers)
+	r.Post("/ledgers", h.createLedger)
+
+	r.Route("/ledgers/{ledgerID}", func(r chi.Router) {
+		r.Use(h.ledgerCtx)
+
+		r.Get("/", h.getLedger)
+		r.Get("/members", h.listMembers)
+		r.Post("/members", h.addMember)
+		r.Get("/expenses", h.listExpenses)
+		r.Post("/expenses", h.createExpense)
+		r.Get("/expenses/{expenseID}", h.getExpense)
+		r.Get("/expenses/{expenseID}/splits", h.listExpenseSplits)
+		r.Get("/settlements", h.listSettlements)
+		r.Post("/settlements", h.createSettlement)
+		r.Get("/balances", h.getBalances)
+		r.Get("/spending", h.listDailySpending)
+	})
+
+	return r
+}
+
+// requireUser rejects requests without an authenticated user
+func requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !middleware.IsAuthenticated(r.Context()) {
+			writeError(w, ErrUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireScope checks the token scope: reads need read, anything else write
+func requireScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := token.ScopeWrite
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			scope = token.ScopeRead
+		}
+
+		if !middleware.HasScope(r.Context(), scope) {
+			writeError(w, ErrInsufficientScope)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ledgerCtx loads the ledger from the URL and makes sure the user is a member
+func (h *Handler) ledgerCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ledgerID := chi.URLParam(r, "ledgerID")
+		if !isUUID(ledgerID) {
+			writeError(w, ErrNotFound)
+			return
+		}
+
+		userID, _ := middleware.GetUserID(r.Context())
+		member, err := h.ledgers.IsMember(r.Context(), ledgerID, userID.String())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if !member {
+			writeError(w, ErrNotFound)
+			return
+		}
+
+		l, err := h.ledgers.GetLedgerByID(r.Context(), ledgerID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if l == nil {
+			writeError(w, ErrNotFound)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ledgerKey, l)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func ledgerFromContext(ctx context.Context) *ledger.Ledger {
+	l, _ := ctx.Value(ledgerKey).(*ledger.Ledger)
+	return l
+}
+
+type listResponse struct {
+	Data       any        `json:"data"`
+	Pagination pagination `json:"pagination"`
+}
+
+type pagination struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// parsePagination reads limit and offset from the query string, using the
+// same page size as the dashboard when none is given
+func parsePagination(r *http.Request) (pagination, error) {
+	p := pagination{Limit: defaultLimit}
+
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return p, ErrInvalidPagination
+		}
+		p.Limit = min(limit, maxLimit)
+	}
+
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return p, ErrInvalidPagination
+		}
+		p.Offset = offset
+	}
+
+	return p, nil
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return ErrInvalidBody
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to encode response", "error", err)
+	}
+}
+
+func isUUID(s string) bool {
+	_, err := uuid.Parse(s)
+	return err == nil
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/billbatista/acasinha-expenses/dberr"
+	"github.com/billbatista/acasinha-expenses/ledger"
+	"github.com/billbatista/acasinha-expenses/user"
+)
+
+var (
+	ErrUnauthorized      = errors.New("authentication required")
+	ErrInsufficientScope = errors.New("token lacks the required scope")
+	ErrNotFound          = errors.New("resource not found")
+	ErrInvalidBody       = errors.New("invalid request body")
+	ErrInvalidPagination = errors.New("limit and offset must be non-negative integers")
+	ErrInvalidUserID     = errors.New("invalid user id")
+	ErrInvalidDateRange  = errors.New("from and to must be YYYY-MM-DD dates, from not after to")
+	ErrTwoFactorRequired = errors.New("two-factor authentication must be set up before using the api")
+)
+
+type errorResponse struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type errorMapping struct {
+	target error
+	status int
+	code   string
+}
+
+// errorMappings translates domain errors into HTTP statuses and stable codes
+// clients can switch on. Anything not listed becomes a 500. The first match
+// wins, so errors that wrap others come before them: domain errors before
+// the generic database ones they may wrap.
+var errorMappings = []errorMapping{
+	{ErrUnauthorized, http.StatusUnauthorized, "unauthorized"},
+	{ErrInsufficientScope, http.StatusForbidden, "insufficient_scope"},
+	{ErrTwoFactorRequired, http.StatusForbidden, "two_factor_required"},
+	{ErrNotFound, http.StatusNotFound, "not_found"},
+	{ErrInvalidBody, http.StatusBadRequest, "invalid_body"},
+	{ErrInvalidPagination, http.StatusBadRequest, "invalid_pagination"},
+	{ErrInvalidUserID, http.StatusBadRequest, "invalid_user_id"},
+	{ErrInvalidDateRange, http.StatusBadRequest, "invalid_date_range"},
+
+	{ledger.ErrEmptyName, http.StatusUnprocessableEntity, "empty_name"},
+	{ledger.ErrEmptyCurrency, http.StatusUnprocessableEntity, "empty_currency"},
+	{ledger.ErrInvalidAmount, http.StatusUnprocessableEntity, "invalid_amount"},
+	{ledger.ErrEmptyDescription, http.StatusUnprocessableEntity, "empty_description"},
+	{ledger.ErrSelfSettlement, http.StatusUnprocessableEntity, "self_settlement"},
+	{ledger.ErrNotMember, http.StatusUnprocessableEntity, "not_member"},
+	{ledger.ErrAlreadyMember, http.StatusConflict, "already_member"},
+	{ledger.ErrNameTaken, http.StatusConflict, "name_taken"},
+	{ledger.ErrLedgerNotFound, http.StatusNotFound, "ledger_not_found"},
+	{ledger.ErrUnknownUser, http.StatusUnprocessableEntity, "unknown_user"},
+
+	{user.ErrEmailExists, http.StatusConflict, "email_exists"},
+	{user.ErrInvalidEmail, http.StatusUnprocessableEntity, "invalid_email"},
+	{user.ErrBlankPassword, http.StatusUnprocessableEntity, "blank_password"},
+	{user.ErrEmailNotVerified, http.StatusForbidden, "email_not_verified"},
+
+	{dberr.ErrUniqueViolation, http.StatusConflict, "conflict"},
+	{dberr.ErrForeignKeyViolation, http.StatusUnprocessableEntity, "invalid_reference"},
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	for _, mapping := range errorMappings {
+		if errors.Is(err, mapping.target) {
+			writeJSON(w, mapping.status, errorResponse{
+				Error: errorDetail{Code: mapping.code, Message: mapping.target.Error()},
+			})
+			return
+		}
+	}
+
+	slog.Error("api request failed", "error", err)
+	writeJSON(w, http.StatusInternalServerError, errorResponse{
+		Error: errorDetail{Code: "internal_error", Message: "internal server error"},
+	})
+}
+
+// TwoFactorRequired answers requests from users who still have to set up
+// the two-factor authentication an admin requires
+func TwoFactorRequired(w http.ResponseWriter, r *http.Request) {
+	writeError(w, ErrTwoFactorRequired)
+}
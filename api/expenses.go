@@ -0,0 +1,226 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/billbatista/acasinha-expenses/ledger"
+	"github.com/billbatista/acasinha-expenses/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type createExpenseRequest struct {
+	Description string           `json:"description"`
+	Amount      int64            `json:"amount"`
+	PaidBy      *uuid.UUID       `json:"paid_by"`
+	SplitType   ledger.SplitType `json:"split_type"`
+	Category    string           `json:"category"`
+}
+
+type createSettlementRequest struct {
+	FromUser *uuid.UUID `json:"from_user"`
+	ToUser   uuid.UUID  `json:"to_user"`
+	Amount   int64      `json:"amount"`
+}
+
+func (h *Handler) listExpenses(w http.ResponseWriter, r *http.Request) {
+	l := ledgerFromContext(r.Context())
+
+	page, err := parsePagination(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	filter := ledger.ExpenseFilter{
+		Limit:    page.Limit,
+		Offset:   page.Offset,
+		Category: r.URL.Query().Get("category"),
+	}
+	if v := r.URL.Query().Get("paid_by"); v != "" {
+		paidBy, err := uuid.Parse(v)
+		if err != nil {
+			writeError(w, ErrInvalidUserID)
+			return
+		}
+		filter.PaidBy = paidBy
+	}
+
+	expenses, err := h.ledgers.GetExpenses(r.Context(), l.ID.String(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if expenses == nil {
+		expenses = []ledger.Expense{}
+	}
+
+	writeJSON(w, http.StatusOK, listResponse{Data: expenses, Pagination: page})
+}
+
+func (h *Handler) createExpense(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := ledgerFromContext(ctx)
+	userID, _ := middleware.GetUserID(ctx)
+
+	var req createExpenseRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	paidBy := userID
+	if req.PaidBy != nil {
+		paidBy = *req.PaidBy
+	}
+	if req.SplitType == "" {
+		req.SplitType = ledger.SplitTypeEqual
+	}
+
+	members, err := h.ledgers.GetLedgerMembers(ctx, l.ID.String())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	memberIDs := make([]uuid.UUID, len(members))
+	isMember := false
+	for i, member := range members {
+		memberIDs[i] = member.UserID
+		isMember = isMember || member.UserID == paidBy
+	}
+	if !isMember {
+		writeError(w, ledger.ErrNotMember)
+		return
+	}
+
+	expense, splits, err := ledger.NewExpense(l.ID, req.Description, req.Amount, paidBy, req.SplitType, req.Category, memberIDs)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err := h.ledgers.SaveExpense(ctx, *expense, splits); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, expense)
+}
+
+func (h *Handler) getExpense(w http.ResponseWriter, r *http.Request) {
+	expense, ok := h.loadExpense(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, expense)
+}
+
+func (h *Handler) listExpenseSplits(w http.ResponseWriter, r *http.Request) {
+	expense, ok := h.loadExpense(w, r)
+	if !ok {
+		return
+	}
+
+	splits, err := h.ledgers.GetSplitsByExpense(r.Context(), expense.ID.String())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if splits == nil {
+		splits = []ledger.ExpenseSplit{}
+	}
+
+	writeJSON(w, http.StatusOK, listResponse{
+		Data:       splits,
+		Pagination: pagination{Limit: len(splits)},
+	})
+}
+
+// loadExpense fetches the expense from the URL, making sure it belongs to
+// the ledger in context. It writes the error response when it returns false.
+func (h *Handler) loadExpense(w http.ResponseWriter, r *http.Request) (*ledger.Expense, bool) {
+	l := ledgerFromContext(r.Context())
+
+	expenseID := chi.URLParam(r, "expenseID")
+	if !isUUID(expenseID) {
+		writeError(w, ErrNotFound)
+		return nil, false
+	}
+
+	expense, err := h.ledgers.GetExpenseByID(r.Context(), expenseID)
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+	if expense == nil || expense.LedgerID != l.ID {
+		writeError(w, ErrNotFound)
+		return nil, false
+	}
+
+	return expense, true
+}
+
+func (h *Handler) listSettlements(w http.ResponseWriter, r *http.Request) {
+	l := ledgerFromContext(r.Context())
+
+	page, err := parsePagination(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	settlements, err := h.ledgers.GetSettlements(r.Context(), l.ID.String(), page.Limit, page.Offset)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if settlements == nil {
+		settlements = []ledger.Settlement{}
+	}
+
+	writeJSON(w, http.StatusOK, listResponse{Data: settlements, Pagination: page})
+}
+
+func (h *Handler) createSettlement(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := ledgerFromContext(ctx)
+	userID, _ := middleware.GetUserID(ctx)
+
+	var req createSettlementRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	from := userID
+	if req.FromUser != nil {
+		from = *req.FromUser
+	}
+
+	for _, memberID := range []uuid.UUID{from, req.ToUser} {
+		member, err := h.ledgers.IsMember(ctx, l.ID.String(), memberID.String())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if !member {
+			writeError(w, ledger.ErrNotMember)
+			return
+		}
+	}
+
+	settlement, err := ledger.NewSettlement(l.ID, from, req.ToUser, req.Amount)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err := h.ledgers.SaveSettlement(ctx, *settlement); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, settlement)
+}
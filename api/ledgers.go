@@ -0,0 +1,211 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/billbatista/acasinha-expenses/ledger"
+	"github.com/billbatista/acasinha-expenses/middleware"
+	"github.com/billbatista/acasinha-expenses/user"
+	"github.com/google/uuid"
+)
+
+type createLedgerRequest struct {
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
+}
+
+type addMemberRequest struct {
+	Email string `json:"email"`
+}
+
+func (h *Handler) listLedgers(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	page, err := parsePagination(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	ledgers, err := h.ledgers.GetUserLedgers(r.Context(), userID.String(), page.Limit, page.Offset)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if ledgers == nil {
+		ledgers = []ledger.Ledger{}
+	}
+
+	writeJSON(w, http.StatusOK, listResponse{Data: ledgers, Pagination: page})
+}
+
+func (h *Handler) createLedger(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	var req createLedgerRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	newLedger, err := ledger.NewLedger(req.Name, req.Currency, userID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if _, err := h.ledgers.CreateNew(r.Context(), newLedger); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newLedger)
+}
+
+func (h *Handler) getLedger(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, ledgerFromContext(r.Context()))
+}
+
+func (h *Handler) listMembers(w http.ResponseWriter, r *http.Request) {
+	l := ledgerFromContext(r.Context())
+
+	members, err := h.ledgers.GetLedgerMembers(r.Context(), l.ID.String())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if members == nil {
+		members = []ledger.LedgerUser{}
+	}
+
+	writeJSON(w, http.StatusOK, listResponse{
+		Data:       members,
+		Pagination: pagination{Limit: len(members)},
+	})
+}
+
+// addMember needs both the user adding and the one added to have verified
+// their email
+func (h *Handler) addMember(w http.ResponseWriter, r *http.Request) {
+	l := ledgerFromContext(r.Context())
+	userID, _ := middleware.GetUserID(r.Context())
+
+	var req addMemberRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	member, err := h.users.GetByEmail(r.Context(), req.Email)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if member == nil {
+		writeError(w, ErrNotFound)
+		return
+	}
+
+	inviter, err := h.users.GetByID(r.Context(), userID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// the account may have been deleted since the session or token was issued
+	if inviter == nil {
+		writeError(w, ErrUnauthorized)
+		return
+	}
+	if !inviter.IsVerified() || !member.IsVerified() {
+		writeError(w, user.ErrEmailNotVerified)
+		return
+	}
+
+	if err := h.ledgers.AddMember(r.Context(), l.ID.String(), member.ID.String()); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, ledger.LedgerUser{LedgerID: l.ID, UserID: member.ID})
+}
+
+func (h *Handler) getBalances(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := ledgerFromContext(ctx)
+
+	members, err := h.ledgers.GetLedgerMembers(ctx, l.ID.String())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	expenses, err := h.ledgers.GetExpenses(ctx, l.ID.String(), ledger.ExpenseFilter{})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	splits, err := h.ledgers.GetExpenseSplits(ctx, l.ID.String())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	settlements, err := h.ledgers.GetSettlements(ctx, l.ID.String(), 0, 0)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	memberIDs := make([]uuid.UUID, len(members))
+	for i, member := range members {
+		memberIDs[i] = member.UserID
+	}
+
+	balances := ledger.CalculateBalances(expenses, splits, settlements, memberIDs)
+
+	result := make([]ledger.Balance, 0, len(balances))
+	for _, memberID := range memberIDs {
+		result = append(result, ledger.Balance{UserID: memberID, Amount: balances[memberID]})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"data": result})
+}
+
+// listDailySpending reads the spending projection, so expenses show up there
+// shortly after they're created
+func (h *Handler) listDailySpending(w http.ResponseWriter, r *http.Request) {
+	l := ledgerFromContext(r.Context())
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	var err error
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = time.Parse(time.DateOnly, v); err != nil {
+			writeError(w, ErrInvalidDateRange)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = time.Parse(time.DateOnly, v); err != nil {
+			writeError(w, ErrInvalidDateRange)
+			return
+		}
+	}
+	if from.After(to) {
+		writeError(w, ErrInvalidDateRange)
+		return
+	}
+
+	spending, err := h.ledgers.GetDailySpending(r.Context(), l.ID.String(), from, to)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if spending == nil {
+		spending = []ledger.DailySpending{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"data": spending})
+}
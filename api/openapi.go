@@ -0,0 +1,312 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/billbatista/acasinha-expenses/ledger"
+	"github.com/billbatista/acasinha-expenses/user"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// operation describes one endpoint of the v1 router. The OpenAPI document is
+// generated from this table, and VerifySpec checks it against the router.
+type operation struct {
+	method   string
+	path     string
+	summary  string
+	request  any
+	response any
+	list     bool
+	status   int
+	query    []string
+}
+
+var operations = []operation{
+	{method: http.MethodGet, path: "/activity", summary: "List what the user did, newest first", response: user.Activity{}, list: true, status: http.StatusOK, query: []string{"limit", "offset"}},
+	{method: http.MethodGet, path: "/ledgers", summary: "List the ledgers the user belongs to", response: ledger.Ledger{}, list: true, status: http.StatusOK, query: []string{"limit", "offset"}},
+	{method: http.MethodPost, path: "/ledgers", summary: "Create a ledger", request: createLedgerRequest{}, response: ledger.Ledger{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/ledgers/{ledgerID}", summary: "Get a ledger", response: ledger.Ledger{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/ledgers/{ledgerID}/members", summary: "List ledger members", response: ledger.LedgerUser{}, list: true, status: http.StatusOK},
+	{method: http.MethodPost, path: "/ledgers/{ledgerID}/members", summary: "Add a member by email", request: addMemberRequest{}, response: ledger.LedgerUser{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/ledgers/{ledgerID}/expenses", summary: "List expenses, newest first", response: ledger.Expense{}, list: true, status: http.StatusOK, query: []string{"limit", "offset", "category", "paid_by"}},
+	{method: http.MethodPost, path: "/ledgers/{ledgerID}/expenses", summary: "Add an expense split between all members", request: createExpenseRequest{}, response: ledger.Expense{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/ledgers/{ledgerID}/expenses/{expenseID}", summary: "Get an expense", response: ledger.Expense{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/ledgers/{ledgerID}/expenses/{expenseID}/splits", summary: "List how an expense was split", response: ledger.ExpenseSplit{}, list: true, status: http.StatusOK},
+	{method: http.MethodGet, path: "/ledgers/{ledgerID}/settlements", summary: "List settlements, newest first", response: ledger.Settlement{}, list: true, status: http.StatusOK, query: []string{"limit", "offset"}},
+	{method: http.MethodPost, path: "/ledgers/{ledgerID}/settlements", summary: "Record a payment between members", request: createSettlementRequest{}, response: ledger.Settlement{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/ledgers/{ledgerID}/balances", summary: "Get the net balance of each member", response: ledger.Balance{}, list: true, status: http.StatusOK},
+	{method: http.MethodGet, path: "/ledgers/{ledgerID}/spending", summary: "Get daily spending per category, last 30 days by default", response: ledger.DailySpending{}, list: true, status: http.StatusOK, query: []string{"from", "to"}},
+}
+
+var queryParams = map[string]map[string]any{
+	"limit":    {"type": "integer", "minimum": 1, "maximum": maxLimit, "default": defaultLimit},
+	"offset":   {"type": "integer", "minimum": 0, "default": 0},
+	"category": {"type": "string"},
+	"paid_by":  {"type": "string", "format": "uuid"},
+	"from":     {"type": "string", "format": "date"},
+	"to":       {"type": "string", "format": "date"},
+}
+
+var (
+	uuidType = reflect.TypeFor[uuid.UUID]()
+	timeType = reflect.TypeFor[time.Time]()
+)
+
+var buildSpec = sync.OnceValues(func() ([]byte, error) {
+	return json.MarshalIndent(Spec(), "", "  ")
+})
+
+// SpecHandler serves the OpenAPI document as JSON
+func SpecHandler(w http.ResponseWriter, r *http.Request) {
+	spec, err := buildSpec()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.Write(spec)
+}
+
+// Spec builds the OpenAPI 3 document for the v1 API
+func Spec() map[string]any {
+	components := map[string]any{
+		"Error":      schemaFor(reflect.TypeFor[errorResponse](), nil),
+		"Pagination": schemaFor(reflect.TypeFor[pagination](), nil),
+	}
+
+	paths := map[string]map[string]any{}
+	for _, op := range operations {
+		if paths[op.path] == nil {
+			paths[op.path] = map[string]any{}
+		}
+		paths[op.path][strings.ToLower(op.method)] = op.spec(components)
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "A Casinha - Despesas API",
+			"version": "v1",
+		},
+		"servers": []map[string]any{{"url": "/api/v1"}},
+		"security": []map[string]any{
+			{"bearerAuth": []string{}},
+			{"cookieAuth": []string{}},
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": components,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+				"cookieAuth": map[string]any{
+					"type": "apiKey", "in": "cookie", "name": "session_token",
+					"description": "Browser session. Requests other than GET must also send the csrf_token cookie value in the X-CSRF-Token header.",
+				},
+			},
+		},
+	}
+}
+
+func (op operation) spec(components map[string]any) map[string]any {
+	var params []map[string]any
+	for _, segment := range strings.Split(op.path, "/") {
+		if strings.HasPrefix(segment, "{") {
+			params = append(params, map[string]any{
+				"name":     strings.Trim(segment, "{}"),
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string", "format": "uuid"},
+			})
+		}
+	}
+	for _, name := range op.query {
+		params = append(params, map[string]any{
+			"name":   name,
+			"in":     "query",
+			"schema": queryParams[name],
+		})
+	}
+
+	schema := schemaFor(reflect.TypeOf(op.response), components)
+	if op.list {
+		schema = map[string]any{
+			"type":     "object",
+			"required": []string{"data"},
+			"properties": map[string]any{
+				"data":       map[string]any{"type": "array", "items": schema},
+				"pagination": map[string]any{"$ref": "#/components/schemas/Pagination"},
+			},
+		}
+	}
+
+	errorRef := map[string]any{
+		"description": "Error",
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Error"}},
+		},
+	}
+
+	spec := map[string]any{
+		"summary":     op.summary,
+		"operationId": operationID(op),
+		"responses": map[string]any{
+			fmt.Sprint(op.status): map[string]any{
+				"description": http.StatusText(op.status),
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": schema},
+				},
+			},
+			"default": errorRef,
+		},
+	}
+	if params != nil {
+		spec["parameters"] = params
+	}
+	if op.request != nil {
+		spec["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": schemaFor(reflect.TypeOf(op.request), components)},
+			},
+		}
+	}
+
+	return spec
+}
+
+// operationID derives a stable id such as getLedgersLedgerIDExpenses
+func operationID(op operation) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(op.method))
+	for _, segment := range strings.Split(op.path, "/") {
+		segment = strings.Trim(segment, "{}")
+		if segment == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(segment[:1]) + segment[1:])
+	}
+	return b.String()
+}
+
+// schemaFor builds a JSON schema from the type's JSON tags. Exported structs
+// from other packages are added to components and referenced; request types
+// and envelopes are inlined.
+func schemaFor(t reflect.Type, components map[string]any) map[string]any {
+	switch {
+	case t == uuidType:
+		return map[string]any{"type": "string", "format": "uuid"}
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := schemaFor(t.Elem(), components)
+		schema["nullable"] = true
+		return schema
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem(), components)}
+	case reflect.Map:
+		return map[string]any{"type": "object"}
+	case reflect.Struct:
+		if components != nil && t.PkgPath() != reflect.TypeFor[operation]().PkgPath() {
+			if _, ok := components[t.Name()]; !ok {
+				components[t.Name()] = schemaFor(t, nil)
+			}
+			return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+		}
+		return structSchema(t, components)
+	default:
+		return map[string]any{}
+	}
+}
+
+func structSchema(t reflect.Type, components map[string]any) map[string]any {
+	properties := map[string]any{}
+	var required []string
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = schemaFor(field.Type, components)
+		if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if required != nil {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// VerifySpec walks the router and reports any route missing from the spec,
+// or documented operation without a handler
+func VerifySpec(routes chi.Routes) error {
+	var registered []string
+	err := chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if len(route) > 1 {
+			route = strings.TrimSuffix(route, "/")
+		}
+		registered = append(registered, method+" "+route)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var documented []string
+	for _, op := range operations {
+		documented = append(documented, op.method+" "+op.path)
+	}
+
+	var drift []string
+	for _, route := range registered {
+		if !slices.Contains(documented, route) {
+			drift = append(drift, "undocumented route "+route)
+		}
+	}
+	for _, op := range documented {
+		if !slices.Contains(registered, op) {
+			drift = append(drift, "documented route without handler "+op)
+		}
+	}
+
+	if drift != nil {
+		slices.Sort(drift)
+		return fmt.Errorf("api spec drift: %s", strings.Join(drift, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestSpecMatchesRoutes(t *testing.T) {
+	routes := NewHandler(nil, nil).Routes()
+
+	if err := VerifySpec(routes); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := Spec()["paths"].(map[string]map[string]any)
+	err := chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if len(route) > 1 {
+			route = strings.TrimSuffix(route, "/")
+		}
+
+		op, ok := paths[route][strings.ToLower(method)].(map[string]any)
+		if !ok {
+			t.Errorf("%s %s is not in the spec", method, route)
+			return nil
+		}
+
+		var documented []string
+		params, _ := op["parameters"].([]map[string]any)
+		for _, param := range params {
+			if param["in"] == "path" {
+				documented = append(documented, param["name"].(string))
+			}
+		}
+		var placeholders []string
+		for _, segment := range strings.Split(route, "/") {
+			if strings.HasPrefix(segment, "{") {
+				placeholders = append(placeholders, strings.Trim(segment, "{}"))
+			}
+		}
+		if !reflect.DeepEqual(documented, placeholders) {
+			t.Errorf("%s %s documents path parameters %v, the route has %v", method, route, documented, placeholders)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifySpecReportsDrift(t *testing.T) {
+	routes := NewHandler(nil, nil).Routes()
+	routes.Get("/users", func(w http.ResponseWriter, r *http.Request) {})
+
+	err := VerifySpec(routes)
+	if err == nil || !strings.Contains(err.Error(), "undocumented route GET /users") {
+		t.Fatalf("VerifySpec() = %v, want the undocumented route reported", err)
+	}
+}
+
+// TestSpecSchemas checks every field the handlers encode is in the schema
+// documented for it, and every schema reference resolves
+func TestSpecSchemas(t *testing.T) {
+	spec := Spec()
+	schemas := spec["components"].(map[string]any)["schemas"].(map[string]any)
+
+	resolve := func(schema map[string]any) map[string]any {
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return schema
+		}
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		resolved, ok := schemas[name].(map[string]any)
+		if !ok {
+			t.Fatalf("unresolved schema reference %s", ref)
+		}
+		return resolved
+	}
+
+	checkFields := func(where string, v any, schema map[string]any) {
+		t.Helper()
+		body, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fields map[string]any
+		if err := json.Unmarshal(body, &fields); err != nil {
+			t.Fatal(err)
+		}
+
+		properties, _ := schema["properties"].(map[string]any)
+		for name := range fields {
+			if _, ok := properties[name]; !ok {
+				t.Errorf("%s: field %q is encoded but not in the schema", where, name)
+			}
+		}
+		required, _ := schema["required"].([]string)
+		for _, name := range required {
+			if _, ok := fields[name]; !ok {
+				t.Errorf("%s: required field %q is never encoded", where, name)
+			}
+		}
+	}
+
+	paths := spec["paths"].(map[string]map[string]any)
+	for _, op := range operations {
+		where := op.method + " " + op.path
+		opSpec := paths[op.path][strings.ToLower(op.method)].(map[string]any)
+
+		response, ok := opSpec["responses"].(map[string]any)[strconv.Itoa(op.status)].(map[string]any)
+		if !ok {
+			t.Errorf("%s: no %d response documented", where, op.status)
+			continue
+		}
+		content := response["content"].(map[string]any)
+		schema := resolve(content["application/json"].(map[string]any)["schema"].(map[string]any))
+
+		if op.list {
+			items := schema["properties"].(map[string]any)["data"].(map[string]any)["items"].(map[string]any)
+			checkFields(where+" response", op.response, resolve(items))
+			resolve(schema["properties"].(map[string]any)["pagination"].(map[string]any))
+		} else {
+			checkFields(where+" response", op.response, schema)
+		}
+
+		if op.request != nil {
+			body := opSpec["requestBody"].(map[string]any)["content"].(map[string]any)["application/json"].(map[string]any)
+			checkFields(where+" request", op.request, resolve(body["schema"].(map[string]any)))
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Command projections lists the event projections and rebuilds them from
+// scratch by replaying the events table:
+//
+//	go run ./cmd/projections list
+//	go run ./cmd/projections rebuild ledger_daily_spending
+//
+// The server keeps projecting while a rebuild runs; the checkpoint lock
+// makes it wait. The rebuild stops at the same settle delay as the server,
+// events recorded since are left to it.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/billbatista/acasinha-expenses/eventlogger"
+	"github.com/billbatista/acasinha-expenses/projections"
+	_ "github.com/lib/pq"
+)
+
+const defaultDatabaseURL = "host=localhost port=5432 user=postgres password=postgres dbname=expenses sslmode=disable"
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		databaseURL = defaultDatabaseURL
+	}
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		printErrorAndExit("database connection", err)
+	}
+	defer db.Close()
+
+	projector := eventlogger.NewProjector(db, time.Second, projections.All())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch os.Args[1] {
+	case "list":
+		for _, name := range projector.Names() {
+			fmt.Println(name)
+		}
+	case "rebuild":
+		if len(os.Args) != 3 {
+			usage()
+		}
+		start := time.Now()
+		n, err := projector.Rebuild(ctx, os.Args[2])
+		if err != nil {
+			printErrorAndExit("rebuilding projection", err)
+		}
+		slog.Info("projection rebuilt", "projection", os.Args[2], "events", n, "took", time.Since(start))
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: projections list | rebuild <name>")
+	os.Exit(2)
+}
+
+func printErrorAndExit(msg string, e error) {
+	slog.Error(msg, "error", e)
+	os.Exit(1)
+}
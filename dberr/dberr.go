@@ -0,0 +1,59 @@
+// Package dberr translates Postgres constraint errors into domain errors, so
+// handlers can tell a duplicate or a dangling reference from a real failure.
+package dberr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Generic errors for violations no repository mapped to a domain error
+var (
+	ErrUniqueViolation     = errors.New("duplicate value")
+	ErrForeignKeyViolation = errors.New("referenced record doesn't exist")
+	ErrNotNullViolation    = errors.New("required value missing")
+	ErrCheckViolation      = errors.New("value not allowed")
+)
+
+// Postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	codeNotNullViolation    = "23502"
+	codeForeignKeyViolation = "23503"
+	codeUniqueViolation     = "23505"
+	codeCheckViolation      = "23514"
+)
+
+// Constraints maps constraint names to the domain error each violation means
+type Constraints map[string]error
+
+// Translate returns the domain error for a constraint violation: the one
+// mapped to the constraint name, or else the generic error for its kind
+// wrapping the original. Other errors, and nil, are returned unchanged.
+func (c Constraints) Translate(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	if domainErr, ok := c[pqErr.Constraint]; ok {
+		return domainErr
+	}
+
+	var kind error
+	switch pqErr.Code {
+	case codeUniqueViolation:
+		kind = ErrUniqueViolation
+	case codeForeignKeyViolation:
+		kind = ErrForeignKeyViolation
+	case codeNotNullViolation:
+		kind = ErrNotNullViolation
+	case codeCheckViolation:
+		kind = ErrCheckViolation
+	default:
+		return err
+	}
+
+	return fmt.Errorf("%w (%s): %w", kind, pqErr.Constraint, err)
+}
@@ -0,0 +1,45 @@
+package eventlogger
+
+import (
+	"context"
+	"maps"
+)
+
+type metadataKey struct{}
+
+// Metadata keys filled in from the request by middleware.EventMetadata
+const (
+	MetadataRequestID = "request_id"
+	MetadataClientIP  = "client_ip"
+	MetadataUserAgent = "user_agent"
+	MetadataUserID    = "user_id"
+	MetadataSessionID = "session_id"
+	// MetadataLedgerID is set by WithPayload for ledger scoped payloads
+	MetadataLedgerID = "ledger_id"
+	// MetadataSchemaVersion is set by WithPayload
+	MetadataSchemaVersion = "schema_version"
+)
+
+// ContextWithMetadata returns a context carrying metadata for the events
+// created from it, merged over any metadata already in ctx
+func ContextWithMetadata(ctx context.Context, metadata map[string]string) context.Context {
+	merged := maps.Clone(MetadataFromContext(ctx))
+	if merged == nil {
+		merged = make(map[string]string, len(metadata))
+	}
+	maps.Copy(merged, metadata)
+	return context.WithValue(ctx, metadataKey{}, merged)
+}
+
+// MetadataFromContext returns the metadata stored in ctx, nil if there's none.
+// The map must not be modified.
+func MetadataFromContext(ctx context.Context) map[string]string {
+	metadata, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return metadata
+}
+
+// NewEventContext is NewEvent with the metadata from ctx, such as the request
+// and user that caused the event. Options can still add or override keys.
+func NewEventContext(ctx context.Context, opts ...EventOption) Event {
+	return NewEvent(append([]EventOption{WithMetadata(MetadataFromContext(ctx))}, opts...)...)
+}
@@ -2,6 +2,7 @@ package eventlogger
 
 import (
 	"context"
+	"maps"
 	"time"
 
 	"github.com/google/uuid"
@@ -29,9 +30,10 @@ func WithData(data any) EventOption {
 	}
 }
 
+// WithMetadata adds the keys to the event metadata, replacing existing ones
 func WithMetadata(metadata map[string]string) EventOption {
 	return func(e *Event) {
-		e.Metadata = metadata
+		maps.Copy(e.Metadata, metadata)
 	}
 }
 
@@ -51,3 +53,23 @@ type EventLogger interface {
 	Save(ctx context.Context, e Event) error
 	GetByType(ctx context.Context, eventType string) ([]Event, error)
 }
+
+// BatchSaver is implemented by loggers that can save many events at once
+type BatchSaver interface {
+	SaveBatch(ctx context.Context, events []Event) error
+}
+
+// SaveAll saves the events in one batch when the logger supports it, one by
+// one otherwise
+func SaveAll(ctx context.Context, logger EventLogger, events []Event) error {
+	if bs, ok := logger.(BatchSaver); ok {
+		return bs.SaveBatch(ctx, events)
+	}
+
+	for _, e := range events {
+		if err := logger.Save(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
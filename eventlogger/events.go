@@ -0,0 +1,275 @@
+package eventlogger
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Payloads of every event the app emits. Field names and JSON tags are part
+// of the stored format: renaming or retyping a field means a new version.
+// Amounts are encoded as strings, as the first events were.
+
+func init() {
+	Register[HealthRequested](1)
+	Register[UserRegistered](1)
+	Register[UserLoggedIn](1)
+	Register[UserNameUpdated](1)
+	Register[UserAvatarUpdated](1)
+	Register[UserPasswordResetRequested](1)
+	Register[UserPasswordReset](1)
+	Register[UserEmailVerified](1)
+	Register[UserPasswordChanged](1)
+	Register[UserEmailChanged](1)
+	Register[UserTwoFactorEnabled](1)
+	Register[UserTwoFactorDisabled](1)
+	Register[UserRecoveryCodeUsed](1)
+	Register[UserLoginFailed](1)
+	Register[UserLockedOut](1)
+	Register[UserSessionRevoked](1)
+	Register[UserSignedOutElsewhere](1)
+	Register[SettingChanged](1)
+	Register[TokenCreated](1)
+	Register[TokenRevoked](1)
+	Register[WebhookCreated](1)
+	Register[LedgerCreated](1)
+	Register[LedgerMemberAdded](1)
+	Register[ExpenseCreated](1)
+	Register[SettlementCreated](1)
+}
+
+var errAmountNotPositive = errors.New("amount must be positive")
+
+type HealthRequested struct {
+	Message    string `json:"message"`
+	HTTPStatus int    `json:"http_status,string"`
+}
+
+func (HealthRequested) EventType() string { return "health_request" }
+
+type UserRegistered struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	SessionID uuid.UUID `json:"session_id"`
+}
+
+func (UserRegistered) EventType() string { return "user.registered" }
+
+func (p UserRegistered) Validate() error {
+	if p.Email == "" {
+		return errors.New("email is required")
+	}
+	return nil
+}
+
+type UserLoggedIn struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	SessionID uuid.UUID `json:"session_id"`
+}
+
+func (UserLoggedIn) EventType() string { return "user.logged_in" }
+
+func (p UserLoggedIn) Validate() error {
+	if p.Email == "" {
+		return errors.New("email is required")
+	}
+	return nil
+}
+
+type UserNameUpdated struct {
+	UserID uuid.UUID `json:"user_id"`
+	Name   string    `json:"name"`
+}
+
+func (UserNameUpdated) EventType() string { return "user.name_updated" }
+
+type UserAvatarUpdated struct {
+	UserID uuid.UUID `json:"user_id"`
+	File   string    `json:"file"`
+}
+
+func (UserAvatarUpdated) EventType() string { return "user.avatar_updated" }
+
+type UserPasswordResetRequested struct {
+	UserID uuid.UUID `json:"user_id"`
+	Email  string    `json:"email"`
+}
+
+func (UserPasswordResetRequested) EventType() string { return "user.password_reset_requested" }
+
+type UserPasswordReset struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (UserPasswordReset) EventType() string { return "user.password_reset" }
+
+type UserEmailVerified struct {
+	UserID uuid.UUID `json:"user_id"`
+	Email  string    `json:"email"`
+}
+
+func (UserEmailVerified) EventType() string { return "user.email_verified" }
+
+type UserPasswordChanged struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (UserPasswordChanged) EventType() string { return "user.password_changed" }
+
+type UserEmailChanged struct {
+	UserID   uuid.UUID `json:"user_id"`
+	OldEmail string    `json:"old_email"`
+	NewEmail string    `json:"new_email"`
+}
+
+func (UserEmailChanged) EventType() string { return "user.email_changed" }
+
+type UserTwoFactorEnabled struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (UserTwoFactorEnabled) EventType() string { return "user.two_factor_enabled" }
+
+type UserTwoFactorDisabled struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (UserTwoFactorDisabled) EventType() string { return "user.two_factor_disabled" }
+
+type UserRecoveryCodeUsed struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CodesLeft int       `json:"codes_left"`
+}
+
+func (UserRecoveryCodeUsed) EventType() string { return "user.recovery_code_used" }
+
+// UserLoginFailed is a wrong email or password. UserID is only set when
+// there's an account with the email.
+type UserLoginFailed struct {
+	UserID   *uuid.UUID `json:"user_id,omitempty"`
+	Email    string     `json:"email"`
+	Failures int        `json:"failures"`
+}
+
+func (UserLoginFailed) EventType() string { return "user.login_failed" }
+
+type UserLockedOut struct {
+	UserID   *uuid.UUID `json:"user_id,omitempty"`
+	Email    string     `json:"email"`
+	Failures int        `json:"failures"`
+	Until    time.Time  `json:"until"`
+}
+
+func (UserLockedOut) EventType() string { return "user.locked_out" }
+
+// UserSessionRevoked is the user ending one of their other sessions
+type UserSessionRevoked struct {
+	UserID    uuid.UUID `json:"user_id"`
+	SessionID uuid.UUID `json:"session_id"`
+}
+
+func (UserSessionRevoked) EventType() string { return "user.session_revoked" }
+
+// UserSignedOutElsewhere is the user ending every session but SessionID
+type UserSignedOutElsewhere struct {
+	UserID    uuid.UUID `json:"user_id"`
+	SessionID uuid.UUID `json:"session_id"`
+}
+
+func (UserSignedOutElsewhere) EventType() string { return "user.signed_out_elsewhere" }
+
+// SettingChanged is an admin changing an application wide setting
+type SettingChanged struct {
+	UserID uuid.UUID `json:"user_id"`
+	Key    string    `json:"key"`
+	Value  string    `json:"value"`
+}
+
+func (SettingChanged) EventType() string { return "admin.setting_changed" }
+
+type TokenCreated struct {
+	UserID  uuid.UUID `json:"user_id"`
+	TokenID uuid.UUID `json:"token_id"`
+	Name    string    `json:"name"`
+}
+
+func (TokenCreated) EventType() string { return "token.created" }
+
+type TokenRevoked struct {
+	UserID  uuid.UUID `json:"user_id"`
+	TokenID uuid.UUID `json:"token_id"`
+}
+
+func (TokenRevoked) EventType() string { return "token.revoked" }
+
+type WebhookCreated struct {
+	UserID    uuid.UUID `json:"user_id"`
+	LedgerID  uuid.UUID `json:"ledger_id"`
+	WebhookID uuid.UUID `json:"webhook_id"`
+	URL       string    `json:"url"`
+}
+
+func (WebhookCreated) EventType() string { return "webhook.created" }
+
+func (p WebhookCreated) LedgerScope() uuid.UUID { return p.LedgerID }
+
+type LedgerCreated struct {
+	LedgerID uuid.UUID `json:"ledger_id"`
+	UserID   uuid.UUID `json:"user_id"`
+	Name     string    `json:"name"`
+	Currency string    `json:"currency"`
+}
+
+func (LedgerCreated) EventType() string { return "ledger.created" }
+
+func (p LedgerCreated) LedgerScope() uuid.UUID { return p.LedgerID }
+
+type LedgerMemberAdded struct {
+	LedgerID uuid.UUID `json:"ledger_id"`
+	UserID   uuid.UUID `json:"user_id"`
+}
+
+func (LedgerMemberAdded) EventType() string { return "ledger.member_added" }
+
+func (p LedgerMemberAdded) LedgerScope() uuid.UUID { return p.LedgerID }
+
+type ExpenseCreated struct {
+	LedgerID    uuid.UUID `json:"ledger_id"`
+	ExpenseID   uuid.UUID `json:"expense_id"`
+	PaidBy      uuid.UUID `json:"paid_by"`
+	Description string    `json:"description"`
+	Category    string    `json:"category"`
+	Amount      int64     `json:"amount,string"`
+}
+
+func (ExpenseCreated) EventType() string { return "expense.created" }
+
+func (p ExpenseCreated) LedgerScope() uuid.UUID { return p.LedgerID }
+
+func (p ExpenseCreated) Validate() error {
+	if p.Amount <= 0 {
+		return errAmountNotPositive
+	}
+	return nil
+}
+
+type SettlementCreated struct {
+	LedgerID     uuid.UUID `json:"ledger_id"`
+	SettlementID uuid.UUID `json:"settlement_id"`
+	FromUser     uuid.UUID `json:"from_user"`
+	ToUser       uuid.UUID `json:"to_user"`
+	Amount       int64     `json:"amount,string"`
+}
+
+func (SettlementCreated) EventType() string { return "settlement.created" }
+
+func (p SettlementCreated) LedgerScope() uuid.UUID { return p.LedgerID }
+
+func (p SettlementCreated) Validate() error {
+	if p.Amount <= 0 {
+		return errAmountNotPositive
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package eventlogger
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// fileEventLogger appends events as JSON lines to a local file, rotating it
+// once it grows past maxBytes and keeping up to maxBackups old files as
+// path.1 (newest) to path.N (oldest)
+type fileEventLogger struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+	mu         sync.Mutex
+	file       *os.File
+	size       int64
+}
+
+func NewFileEventLogger(path string, maxBytes int64, maxBackups int) *fileEventLogger {
+	return &fileEventLogger{
+		path:       path,
+		maxBytes:   maxBytes,
+		maxBackups: maxBackups,
+	}
+}
+
+func (el *fileEventLogger) Save(ctx context.Context, e Event) error {
+	return el.SaveBatch(ctx, []Event{e})
+}
+
+func (el *fileEventLogger) SaveBatch(ctx context.Context, events []Event) error {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	for _, e := range events {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+
+		if err := el.open(); err != nil {
+			return err
+		}
+		if el.size > 0 && el.size+int64(len(line)) > el.maxBytes {
+			if err := el.rotate(); err != nil {
+				return err
+			}
+		}
+
+		n, err := el.file.Write(line)
+		el.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetByType scans the current file and its backups, oldest first
+func (el *fileEventLogger) GetByType(ctx context.Context, eventType string) ([]Event, error) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	events := make([]Event, 0)
+	for i := el.maxBackups; i >= 0; i-- {
+		f, err := os.Open(el.backupPath(i))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return events, err
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+		for scanner.Scan() {
+			var e Event
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.Type != eventType {
+				continue
+			}
+			events = append(events, e)
+		}
+		f.Close()
+
+		if err := scanner.Err(); err != nil {
+			return events, err
+		}
+	}
+
+	return events, nil
+}
+
+func (el *fileEventLogger) Close() error {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	if el.file == nil {
+		return nil
+	}
+	err := el.file.Close()
+	el.file = nil
+	return err
+}
+
+func (el *fileEventLogger) open() error {
+	if el.file != nil {
+		return nil
+	}
+
+	f, err := os.OpenFile(el.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	el.file = f
+	el.size = info.Size()
+	return nil
+}
+
+func (el *fileEventLogger) rotate() error {
+	if err := el.file.Close(); err != nil {
+		return err
+	}
+	el.file = nil
+
+	if el.maxBackups == 0 {
+		if err := os.Remove(el.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return el.open()
+	}
+
+	for i := el.maxBackups - 1; i >= 0; i-- {
+		err := os.Rename(el.backupPath(i), el.backupPath(i+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return el.open()
+}
+
+func (el *fileEventLogger) backupPath(i int) string {
+	if i == 0 {
+		return el.path
+	}
+	return fmt.Sprintf("%s.%d", el.path, i)
+}
@@ -0,0 +1,109 @@
+package eventlogger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+)
+
+// ErrNotSupported is returned by sinks that can only write events
+var ErrNotSupported = errors.New("operation not supported by this event logger")
+
+// MultiLogger fans each event out to a primary sink and secondary ones.
+// Only the primary's errors are returned, so the caller retries or spills
+// an event when the primary, usually SQL, didn't get it; a failing or
+// panicking secondary is logged and counted but doesn't fail the call,
+// otherwise a retry would write the event again to every sink that did
+// get it.
+type MultiLogger struct {
+	primary   Sink
+	secondary []Sink
+	failures  []atomic.Int64
+}
+
+// Sink is an EventLogger under the name it's configured with, which labels
+// its errors and stats
+type Sink struct {
+	Name   string
+	Logger EventLogger
+}
+
+// SinkStats are running totals for one secondary sink
+type SinkStats struct {
+	Sink     string `json:"sink"`
+	Failures int64  `json:"failures"`
+}
+
+func NewMultiLogger(primary Sink, secondary ...Sink) *MultiLogger {
+	return &MultiLogger{
+		primary:   primary,
+		secondary: secondary,
+		failures:  make([]atomic.Int64, len(secondary)),
+	}
+}
+
+func (m *MultiLogger) Save(ctx context.Context, e Event) error {
+	if err := isolate(m.primary, func() error { return m.primary.Logger.Save(ctx, e) }); err != nil {
+		return err
+	}
+	for i, sink := range m.secondary {
+		m.record(i, isolate(sink, func() error { return sink.Logger.Save(ctx, e) }))
+	}
+	return nil
+}
+
+func (m *MultiLogger) SaveBatch(ctx context.Context, events []Event) error {
+	if err := isolate(m.primary, func() error { return SaveAll(ctx, m.primary.Logger, events) }); err != nil {
+		return err
+	}
+	for i, sink := range m.secondary {
+		m.record(i, isolate(sink, func() error { return SaveAll(ctx, sink.Logger, events) }))
+	}
+	return nil
+}
+
+// Stats returns the failures of each secondary sink
+func (m *MultiLogger) Stats() []SinkStats {
+	stats := make([]SinkStats, len(m.secondary))
+	for i, sink := range m.secondary {
+		stats[i] = SinkStats{Sink: sink.Name, Failures: m.failures[i].Load()}
+	}
+	return stats
+}
+
+func (m *MultiLogger) record(i int, err error) {
+	if err == nil {
+		return
+	}
+	m.failures[i].Add(1)
+	slog.Error("failed to save events to secondary sink", "sink", m.secondary[i].Name, "error", err)
+}
+
+// GetByType reads from the first sink able to answer, the primary first
+func (m *MultiLogger) GetByType(ctx context.Context, eventType string) ([]Event, error) {
+	for _, sink := range append([]Sink{m.primary}, m.secondary...) {
+		events, err := sink.Logger.GetByType(ctx, eventType)
+		if errors.Is(err, ErrNotSupported) {
+			continue
+		}
+		return events, err
+	}
+	return nil, ErrNotSupported
+}
+
+// isolate runs fn turning a panic into an error, tagged with the sink it came from
+func isolate(sink Sink, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("event sink panicked", "sink", sink.Name, "panic", r)
+			err = fmt.Errorf("sink %s panicked: %v", sink.Name, r)
+		}
+	}()
+
+	if err := fn(); err != nil {
+		return fmt.Errorf("sink %s: %w", sink.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package eventlogger
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// AddToOutbox stores events in the outbox within the caller's transaction, so
+// they're only published if the domain write commits. Invalid events fail
+// the transaction.
+func AddToOutbox(ctx context.Context, tx *sql.Tx, events ...Event) error {
+	statement := `INSERT INTO event_outbox (id, event_type, event_data, event_metadata, created_at) VALUES ($1, $2, $3, $4, $5)`
+	for _, e := range events {
+		if err := Validate(e); err != nil {
+			return err
+		}
+
+		jsonData, err := json.Marshal(e.Data)
+		if err != nil {
+			return err
+		}
+		jsonMetadata, err := json.Marshal(e.Metadata)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, statement, e.ID, e.Type, jsonData, jsonMetadata, e.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Relay moves events from the outbox to an EventLogger. An event is removed
+// from the outbox only after it's saved, so delivery is at-least-once and
+// sinks must treat the event ID as an idempotency key.
+type Relay struct {
+	db        *sql.DB
+	logger    EventLogger
+	interval  time.Duration
+	batchSize int
+	wg        sync.WaitGroup
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+func NewRelay(db *sql.DB, logger EventLogger, interval time.Duration, batchSize int) *Relay {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Relay{
+		db:        db,
+		logger:    logger,
+		interval:  interval,
+		batchSize: batchSize,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+func (r *Relay) Start() {
+	r.wg.Go(func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-ticker.C:
+				// keep going while full batches come back, so a backlog drains quickly
+				for {
+					n, err := r.RelayPending(r.ctx)
+					if err != nil {
+						slog.Error("failed to relay outbox events", "error", err)
+						break
+					}
+					if n < r.batchSize {
+						break
+					}
+				}
+			}
+		}
+	})
+}
+
+func (r *Relay) Shutdown() {
+	r.cancel()
+	r.wg.Wait()
+
+	// one last pass so events committed right before shutdown go out now
+	if _, err := r.RelayPending(context.Background()); err != nil {
+		slog.Error("failed to relay outbox events during shutdown", "error", err)
+	}
+}
+
+// RelayPending publishes one batch of outbox events in creation order and
+// returns how many were published. It stops at the first failure so the
+// remaining events keep their order for the next run.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT id, event_type, event_data, event_metadata, created_at 
+              FROM event_outbox 
+              ORDER BY created_at ASC 
+              LIMIT $1 
+              FOR UPDATE SKIP LOCKED`
+
+	rows, err := tx.QueryContext(ctx, query, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var events []Event
+	for rows.Next() {
+		var event Event
+		var jsonData, jsonMetadata []byte
+		if err := rows.Scan(&event.ID, &event.Type, &jsonData, &jsonMetadata, &event.CreatedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		event.Data = json.RawMessage(jsonData)
+		if err := json.Unmarshal(jsonMetadata, &event.Metadata); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	published := 0
+	var saveErr error
+	for _, event := range events {
+		if saveErr = r.logger.Save(ctx, event); saveErr != nil {
+			slog.Error("failed to publish outbox event", "error", saveErr, "event_id", event.ID, "event_type", event.Type)
+			break
+		}
+
+		_, err := tx.ExecContext(ctx, `DELETE FROM event_outbox WHERE id = $1`, event.ID)
+		if err != nil {
+			return 0, err
+		}
+		published++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return published, saveErr
+}
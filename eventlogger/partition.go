@@ -0,0 +1,137 @@
+package eventlogger
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Monthly partitions of the events table are named events_YYYY_MM, see
+// migrations/optional
+const partitionNameLayout = "events_2006_01"
+
+func isPartitioned(ctx context.Context, db *sql.DB) (bool, error) {
+	query := `SELECT EXISTS (
+                  SELECT 1 FROM pg_partitioned_table pt
+                  JOIN pg_class c ON c.oid = pt.partrelid
+                  WHERE c.relname = 'events' AND pg_table_is_visible(c.oid)
+              )`
+
+	var partitioned bool
+	err := db.QueryRowContext(ctx, query).Scan(&partitioned)
+	return partitioned, err
+}
+
+// ensurePartitions creates the partitions for the current month and the
+// next ones, so inserts never land in the default partition
+func ensurePartitions(ctx context.Context, db *sql.DB, now time.Time, ahead int) error {
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= ahead; i++ {
+		from := month.AddDate(0, i, 0)
+		to := from.AddDate(0, 1, 0)
+		statement := fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS %s PARTITION OF events FOR VALUES FROM (%s) TO (%s)`,
+			pq.QuoteIdentifier(from.Format(partitionNameLayout)),
+			pq.QuoteLiteral(from.Format(time.RFC3339)),
+			pq.QuoteLiteral(to.Format(time.RFC3339)),
+		)
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropExpiredPartitions drops the monthly partitions that end before the
+// longest retention. That only happens with a "*" policy, otherwise some
+// types are kept forever. Rows still in a partition are archived first.
+func (p *Pruner) dropExpiredPartitions(ctx context.Context, now time.Time) (int, error) {
+	var longest time.Duration
+	hasDefault := false
+	for _, policy := range p.policies {
+		longest = max(longest, policy.MaxAge)
+		hasDefault = hasDefault || policy.EventType == "*"
+	}
+	if !hasDefault {
+		return 0, nil
+	}
+	cutoff := now.Add(-longest)
+
+	rows, err := p.db.QueryContext(ctx, `SELECT c.relname 
+                                         FROM pg_inherits i 
+                                         JOIN pg_class c ON c.oid = i.inhrelid 
+                                         JOIN pg_class parent ON parent.oid = i.inhparent 
+                                         WHERE parent.relname = 'events'`)
+	if err != nil {
+		return 0, err
+	}
+	var expired []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		month, err := time.Parse(partitionNameLayout, name)
+		if err != nil {
+			// the default partition, or one not created by us
+			continue
+		}
+		if !month.AddDate(0, 1, 0).After(cutoff) {
+			expired = append(expired, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, name := range expired {
+		n, err := p.archivePartition(ctx, name)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("archiving partition %s: %w", name, err)
+		}
+
+		if _, err := p.db.ExecContext(ctx, `ALTER TABLE events DETACH PARTITION `+pq.QuoteIdentifier(name)); err != nil {
+			return total, err
+		}
+		if _, err := p.db.ExecContext(ctx, `DROP TABLE `+pq.QuoteIdentifier(name)); err != nil {
+			return total, err
+		}
+		slog.Info("dropped expired event partition", "partition", name, "archived", n)
+	}
+
+	return total, nil
+}
+
+// archivePartition moves every row left in the partition to its own archive
+func (p *Pruner) archivePartition(ctx context.Context, name string) (int, error) {
+	path := filepath.Join(p.archiveDir, name+".jsonl.gz")
+	query := `SELECT id, event_type, event_data, event_metadata, created_at 
+              FROM ` + pq.QuoteIdentifier(name) + ` 
+              ORDER BY created_at, id 
+              LIMIT $1`
+
+	total := 0
+	for {
+		events, err := p.queryEvents(ctx, query, p.batchSize)
+		if err != nil || len(events) == 0 {
+			return total, err
+		}
+
+		if err := appendArchive(path, events); err != nil {
+			return total, err
+		}
+		if err := p.deleteEvents(ctx, name, events); err != nil {
+			return total, err
+		}
+		total += len(events)
+	}
+}
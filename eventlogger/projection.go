@@ -0,0 +1,259 @@
+package eventlogger
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var ErrUnknownProjection = errors.New("unknown projection")
+
+// Projection builds a read model from events. Apply and Reset run inside the
+// transaction that also moves the checkpoint, so a read model in the same
+// database sees every event exactly once.
+type Projection interface {
+	// Name identifies the projection's checkpoint, changing it rebuilds it
+	Name() string
+	// Types lists the event types to apply, all of them when empty
+	Types() []string
+	Apply(ctx context.Context, tx *sql.Tx, e Event) error
+	// Reset clears the read model before a rebuild
+	Reset(ctx context.Context, tx *sql.Tx) error
+}
+
+// Projector feeds events to projections in the order they were recorded in
+// the table, (recorded_at, id), keeping a checkpoint per projection in
+// projection_checkpoints.
+//
+// Events reach the table asynchronously, through the worker, the outbox or
+// replayed spills, often well after they were created; following the
+// recording order rather than created_at means none is skipped. Only events
+// recorded more than settleDelay ago are projected, so transactions still
+// inserting events recorded earlier have time to commit.
+type Projector struct {
+	db          *sql.DB
+	projections []Projection
+	interval    time.Duration
+	batchSize   int
+	settleDelay time.Duration
+	wg          sync.WaitGroup
+	ctx         context.Context
+	cancel      context.CancelFunc
+}
+
+type ProjectorOption func(*Projector)
+
+// WithSettleDelay sets how long ago an event must have been recorded
+// before it's projected. Defaults to 30 seconds.
+func WithSettleDelay(d time.Duration) ProjectorOption {
+	return func(p *Projector) {
+		p.settleDelay = d
+	}
+}
+
+// WithProjectionBatchSize sets how many events are applied per transaction
+func WithProjectionBatchSize(n int) ProjectorOption {
+	return func(p *Projector) {
+		p.batchSize = max(n, 1)
+	}
+}
+
+func NewProjector(db *sql.DB, interval time.Duration, projections []Projection, opts ...ProjectorOption) *Projector {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Projector{
+		db:          db,
+		projections: projections,
+		interval:    interval,
+		batchSize:   500,
+		settleDelay: 30 * time.Second,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func (p *Projector) Start() {
+	p.wg.Go(func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			for _, projection := range p.projections {
+				if _, err := p.CatchUp(p.ctx, projection); err != nil {
+					slog.Error("failed to run projection", "projection", projection.Name(), "error", err)
+				}
+			}
+
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+func (p *Projector) Shutdown() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+// CatchUp applies every settled event past the projection's checkpoint and
+// returns how many were applied
+func (p *Projector) CatchUp(ctx context.Context, projection Projection) (int, error) {
+	total := 0
+	for {
+		n, err := p.applyBatch(ctx, projection)
+		total += n
+		if err != nil || n < p.batchSize {
+			return total, err
+		}
+	}
+}
+
+// Rebuild resets the named projection and replays the whole events table
+// into it
+func (p *Projector) Rebuild(ctx context.Context, name string) (int, error) {
+	projection, err := p.projection(name)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := lockCheckpoint(ctx, tx, name); err != nil {
+		return 0, err
+	}
+	if err := projection.Reset(ctx, tx); err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE projection_checkpoints SET last_recorded_at = NULL, last_event_id = NULL, updated_at = now() WHERE name = $1`, name)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return p.CatchUp(ctx, projection)
+}
+
+// Names lists the registered projections
+func (p *Projector) Names() []string {
+	names := make([]string, len(p.projections))
+	for i, projection := range p.projections {
+		names[i] = projection.Name()
+	}
+	return names
+}
+
+func (p *Projector) projection(name string) (Projection, error) {
+	for _, projection := range p.projections {
+		if projection.Name() == name {
+			return projection, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownProjection, name)
+}
+
+// applyBatch applies the next batch and moves the checkpoint in one
+// transaction. The checkpoint row lock keeps other instances out meanwhile.
+func (p *Projector) applyBatch(ctx context.Context, projection Projection) (int, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := lockCheckpoint(ctx, tx, projection.Name()); err != nil {
+		return 0, err
+	}
+
+	var lastRecordedAt sql.NullTime
+	var lastID uuid.NullUUID
+	err = tx.QueryRowContext(ctx, `SELECT last_recorded_at, last_event_id FROM projection_checkpoints WHERE name = $1`, projection.Name()).
+		Scan(&lastRecordedAt, &lastID)
+	if err != nil {
+		return 0, err
+	}
+
+	conditions := []string{"recorded_at < $1"}
+	args := []any{time.Now().Add(-p.settleDelay)}
+	if lastRecordedAt.Valid {
+		args = append(args, lastRecordedAt.Time, lastID.UUID)
+		conditions = append(conditions, fmt.Sprintf("(recorded_at, id) > ($%d, $%d)", len(args)-1, len(args)))
+	}
+	if types := projection.Types(); len(types) > 0 {
+		args = append(args, pq.Array(types))
+		conditions = append(conditions, fmt.Sprintf("event_type = ANY($%d)", len(args)))
+	}
+	args = append(args, p.batchSize)
+
+	query := `SELECT id, event_type, event_data, event_metadata, created_at, recorded_at 
+              FROM events 
+              WHERE ` + strings.Join(conditions, " AND ") + ` 
+              ORDER BY recorded_at, id 
+              LIMIT ` + fmt.Sprintf("$%d", len(args))
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	var events []Event
+	var lastRecorded time.Time
+	for rows.Next() {
+		event, recordedAt, err := scanRecordedEvent(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		events = append(events, *event)
+		lastRecorded = recordedAt
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	for _, e := range events {
+		if err := projection.Apply(ctx, tx, e); err != nil {
+			return 0, fmt.Errorf("applying event %s: %w", e.ID, err)
+		}
+	}
+
+	last := events[len(events)-1]
+	_, err = tx.ExecContext(ctx, `UPDATE projection_checkpoints SET last_recorded_at = $2, last_event_id = $3, updated_at = now() WHERE name = $1`,
+		projection.Name(), lastRecorded, last.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(events), tx.Commit()
+}
+
+func lockCheckpoint(ctx context.Context, tx *sql.Tx, name string) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO projection_checkpoints (name) VALUES ($1) ON CONFLICT DO NOTHING`, name)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `SELECT 1 FROM projection_checkpoints WHERE name = $1 FOR UPDATE`, name)
+	return err
+}
@@ -0,0 +1,147 @@
+package eventlogger
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	defaultQueryLimit = 50
+	maxQueryLimit     = 500
+)
+
+// Filter narrows down which events are returned. Zero values are ignored.
+type Filter struct {
+	Types []string
+	From  time.Time
+	To    time.Time
+	// Metadata matches events whose metadata contains every key/value pair
+	Metadata map[string]string
+	// LedgerID matches ledger_id in the event metadata or data
+	LedgerID uuid.UUID
+	// UserID matches user_id in the event metadata or data
+	UserID uuid.UUID
+	Limit  int
+	// Cursor continues from the NextCursor of a previous page
+	Cursor string
+}
+
+type Page struct {
+	Events []RecordedEvent
+	// NextCursor is empty on the last page
+	NextCursor string
+}
+
+type TypeCount struct {
+	Type  string
+	Count int64
+}
+
+// RecordedEvent is an event along with when it was inserted in the table,
+// which can be long after it was created
+type RecordedEvent struct {
+	Event
+	RecordedAt time.Time
+}
+
+// Position is a point in the order events were recorded in
+type Position struct {
+	RecordedAt time.Time
+	ID         uuid.UUID
+}
+
+func (e RecordedEvent) Position() Position {
+	return Position{RecordedAt: e.RecordedAt, ID: e.ID}
+}
+
+// EventQuerier reads events back. Results are ordered newest first, except
+// for QueryRecorded.
+type EventQuerier interface {
+	Query(ctx context.Context, filter Filter) (Page, error)
+	// QueryRecorded returns up to filter.Limit events matching the filter
+	// recorded after the given position, oldest first. The cursor is ignored.
+	QueryRecorded(ctx context.Context, filter Filter, after Position) ([]RecordedEvent, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*Event, error)
+	Count(ctx context.Context, filter Filter) (int64, error)
+	CountByType(ctx context.Context, filter Filter) ([]TypeCount, error)
+}
+
+// DecodeData unmarshals the event data into v, which may be any type the
+// JSON payload fits, such as a struct or map[string]any
+func (e Event) DecodeData(v any) error {
+	var raw []byte
+	switch data := e.Data.(type) {
+	case json.RawMessage:
+		raw = data
+	case []byte:
+		raw = data
+	default:
+		var err error
+		raw, err = json.Marshal(data)
+		if err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func (f Filter) limit() int {
+	if f.Limit <= 0 {
+		return defaultQueryLimit
+	}
+	return min(f.Limit, maxQueryLimit)
+}
+
+type cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func encodeCursor(e Event) string {
+	raw := e.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + e.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	createdAt, id, found := strings.Cut(string(raw), "|")
+	if !found {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	var c cursor
+	if c.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	if c.ID, err = uuid.Parse(id); err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// decodeJSONData turns stored JSON into map[string]any for objects, or the
+// matching Go value otherwise
+func decodeJSONData(raw []byte) (any, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var data any
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
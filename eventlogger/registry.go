@@ -0,0 +1,190 @@
+package eventlogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnknownEventType   = errors.New("unknown event type")
+	ErrInvalidPayload     = errors.New("invalid event payload")
+	ErrUnsupportedVersion = errors.New("unsupported event schema version")
+	ErrEventTypeMismatch  = errors.New("event type doesn't match payload")
+	ErrDuplicateEventType = errors.New("event type already registered")
+)
+
+var (
+	uuidType   = reflect.TypeFor[uuid.UUID]()
+	registryMu sync.RWMutex
+	registry   = map[string]schema{}
+)
+
+// Payload is the typed data of an event. Each event type has one payload
+// struct, registered with Register.
+type Payload interface {
+	EventType() string
+}
+
+// LedgerScoped is implemented by payloads of events that happen within a
+// ledger, so the ledger ID is recorded in the metadata for feeds and webhooks
+type LedgerScoped interface {
+	LedgerScope() uuid.UUID
+}
+
+// Validator is implemented by payloads with rules beyond the required IDs
+type Validator interface {
+	Validate() error
+}
+
+type schema struct {
+	version int
+	typ     reflect.Type
+}
+
+// Register adds the payload type to the registry under its event type. The
+// version is bumped whenever the payload shape changes and stored with every
+// event in the schema_version metadata key.
+func Register[T Payload](version int) {
+	var zero T
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[zero.EventType()]; ok {
+		panic(fmt.Sprintf("%s: %s", ErrDuplicateEventType, zero.EventType()))
+	}
+	registry[zero.EventType()] = schema{version: version, typ: reflect.TypeFor[T]()}
+}
+
+// SchemaVersion returns the current version of a registered event type
+func SchemaVersion(eventType string) (int, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	s, ok := registry[eventType]
+	return s.version, ok
+}
+
+// WithPayload sets the event type, data and schema version from the payload,
+// and the ledger ID for ledger scoped ones
+func WithPayload(p Payload) EventOption {
+	return func(e *Event) {
+		e.Type = p.EventType()
+		e.Data = p
+		if version, ok := SchemaVersion(e.Type); ok {
+			e.Metadata[MetadataSchemaVersion] = strconv.Itoa(version)
+		}
+		if scoped, ok := p.(LedgerScoped); ok {
+			e.Metadata[MetadataLedgerID] = scoped.LedgerScope().String()
+		}
+	}
+}
+
+// Validate checks the event type is registered and its data decodes into the
+// registered payload without unknown fields, with every UUID field set and
+// the payload's own rules met
+func Validate(e Event) error {
+	registryMu.RLock()
+	s, ok := registry[e.Type]
+	registryMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownEventType, e.Type)
+	}
+
+	if v, ok := e.Metadata[MetadataSchemaVersion]; ok {
+		version, err := strconv.Atoi(v)
+		if err != nil || version != s.version {
+			return fmt.Errorf("%w: %s version %s", ErrUnsupportedVersion, e.Type, v)
+		}
+	}
+
+	raw, err := json.Marshal(e.Data)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidPayload, e.Type, err)
+	}
+	payload := reflect.New(s.typ)
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(payload.Interface()); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidPayload, e.Type, err)
+	}
+
+	value := payload.Elem()
+	for i := range s.typ.NumField() {
+		field := s.typ.Field(i)
+		if field.Type == uuidType && value.Field(i).Interface() == uuid.Nil {
+			return fmt.Errorf("%w: %s: %s is required", ErrInvalidPayload, e.Type, field.Name)
+		}
+	}
+
+	if v, ok := payload.Interface().(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidPayload, e.Type, err)
+		}
+	}
+
+	return nil
+}
+
+// Decode reads the event data back into its typed payload. Events stored
+// without a schema version are taken as version 1.
+func Decode[T Payload](e Event) (T, error) {
+	var payload T
+	if e.Type != payload.EventType() {
+		return payload, fmt.Errorf("%w: %s into %T", ErrEventTypeMismatch, e.Type, payload)
+	}
+
+	if err := checkVersion(e); err != nil {
+		return payload, err
+	}
+
+	err := e.DecodeData(&payload)
+	return payload, err
+}
+
+// DecodePayload is Decode for callers that don't know the event type
+// upfront. The returned payload is a pointer to the registered struct.
+func DecodePayload(e Event) (Payload, error) {
+	registryMu.RLock()
+	s, ok := registry[e.Type]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEventType, e.Type)
+	}
+
+	if err := checkVersion(e); err != nil {
+		return nil, err
+	}
+
+	payload := reflect.New(s.typ)
+	if err := e.DecodeData(payload.Interface()); err != nil {
+		return nil, err
+	}
+	return payload.Interface().(Payload), nil
+}
+
+// checkVersion rejects events written by a newer schema than this build knows
+func checkVersion(e Event) error {
+	current, ok := SchemaVersion(e.Type)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownEventType, e.Type)
+	}
+
+	version := 1
+	if v, ok := e.Metadata[MetadataSchemaVersion]; ok {
+		var err error
+		if version, err = strconv.Atoi(v); err != nil {
+			return fmt.Errorf("%w: %s version %s", ErrUnsupportedVersion, e.Type, v)
+		}
+	}
+	if version > current {
+		return fmt.Errorf("%w: %s version %d, latest known is %d", ErrUnsupportedVersion, e.Type, version, current)
+	}
+	return nil
+}
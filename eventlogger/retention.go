@@ -0,0 +1,272 @@
+package eventlogger
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const archiveTimeLayout = "20060102T150405Z"
+
+// RetentionPolicy sets how long events of a type are kept. EventType is an
+// exact type, a prefix such as "user.*", or "*" for every type without a
+// more specific policy. Types matching no policy are kept forever.
+type RetentionPolicy struct {
+	EventType string
+	MaxAge    time.Duration
+}
+
+func (p RetentionPolicy) matches(eventType string) bool {
+	if p.EventType == "*" || p.EventType == eventType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(p.EventType, "*")
+	return ok && strings.HasPrefix(eventType, prefix)
+}
+
+// Pruner archives events past their retention to gzip compressed JSON lines
+// files in archiveDir, then deletes them. When the events table is
+// partitioned by month it also creates upcoming partitions and drops the
+// ones older than every policy.
+type Pruner struct {
+	db         *sql.DB
+	policies   []RetentionPolicy
+	archiveDir string
+	interval   time.Duration
+	batchSize  int
+	wg         sync.WaitGroup
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+func NewPruner(db *sql.DB, policies []RetentionPolicy, archiveDir string, interval time.Duration) *Pruner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Pruner{
+		db:         db,
+		policies:   policies,
+		archiveDir: archiveDir,
+		interval:   interval,
+		batchSize:  1000,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+func (p *Pruner) Start() {
+	p.wg.Go(func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			n, err := p.Prune(p.ctx, time.Now())
+			if err != nil {
+				slog.Error("failed to prune events", "error", err, "archived", n)
+			} else if n > 0 {
+				slog.Info("pruned expired events", "archived", n)
+			}
+
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+func (p *Pruner) Shutdown() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+// Prune archives and deletes every event past its retention as of now,
+// returning how many were archived
+func (p *Pruner) Prune(ctx context.Context, now time.Time) (int, error) {
+	if err := os.MkdirAll(p.archiveDir, 0o755); err != nil {
+		return 0, err
+	}
+
+	partitioned, err := isPartitioned(ctx, p.db)
+	if err != nil {
+		return 0, err
+	}
+	if partitioned {
+		if err := ensurePartitions(ctx, p.db, now, 2); err != nil {
+			return 0, err
+		}
+	}
+
+	types, err := p.eventTypes(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, eventType := range types {
+		policy, ok := p.policyFor(eventType)
+		if !ok {
+			continue
+		}
+
+		n, err := p.pruneType(ctx, eventType, now.Add(-policy.MaxAge), now)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("pruning %s: %w", eventType, err)
+		}
+	}
+
+	if partitioned {
+		n, err := p.dropExpiredPartitions(ctx, now)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// policyFor picks the most specific policy for the type: an exact match,
+// then the longest prefix, then "*"
+func (p *Pruner) policyFor(eventType string) (RetentionPolicy, bool) {
+	var best RetentionPolicy
+	found := false
+	for _, policy := range p.policies {
+		if !policy.matches(eventType) {
+			continue
+		}
+		if policy.EventType == eventType {
+			return policy, true
+		}
+		if !found || len(policy.EventType) > len(best.EventType) {
+			best, found = policy, true
+		}
+	}
+	return best, found
+}
+
+// eventTypes lists the distinct types stored, skipping through
+// idx_events_type_created_at instead of scanning the whole table
+func (p *Pruner) eventTypes(ctx context.Context) ([]string, error) {
+	query := `WITH RECURSIVE types AS (
+                  (SELECT event_type FROM events ORDER BY event_type LIMIT 1)
+                  UNION ALL
+                  SELECT (SELECT e.event_type FROM events e WHERE e.event_type > t.event_type ORDER BY e.event_type LIMIT 1)
+                  FROM types t
+                  WHERE t.event_type IS NOT NULL
+              )
+              SELECT event_type FROM types WHERE event_type IS NOT NULL`
+
+	rows, err := p.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var types []string
+	for rows.Next() {
+		var eventType string
+		if err := rows.Scan(&eventType); err != nil {
+			return nil, err
+		}
+		types = append(types, eventType)
+	}
+
+	return types, rows.Err()
+}
+
+// pruneType moves events of the type created before cutoff to one archive
+// file, a batch at a time. Each batch is on disk before it's deleted.
+func (p *Pruner) pruneType(ctx context.Context, eventType string, cutoff, now time.Time) (int, error) {
+	path := filepath.Join(p.archiveDir, fmt.Sprintf("events-%s-%s.jsonl.gz", eventType, now.UTC().Format(archiveTimeLayout)))
+	query := `SELECT id, event_type, event_data, event_metadata, created_at 
+              FROM events 
+              WHERE event_type = $1 AND created_at < $2 
+              ORDER BY created_at, id 
+              LIMIT $3`
+
+	total := 0
+	for {
+		events, err := p.queryEvents(ctx, query, eventType, cutoff, p.batchSize)
+		if err != nil || len(events) == 0 {
+			return total, err
+		}
+
+		if err := appendArchive(path, events); err != nil {
+			return total, err
+		}
+		if err := p.deleteEvents(ctx, "events", events); err != nil {
+			return total, err
+		}
+		total += len(events)
+
+		if len(events) < p.batchSize {
+			return total, nil
+		}
+	}
+}
+
+func (p *Pruner) queryEvents(ctx context.Context, query string, args ...any) ([]Event, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+
+	return events, rows.Err()
+}
+
+func (p *Pruner) deleteEvents(ctx context.Context, table string, events []Event) error {
+	ids := make([]string, len(events))
+	for i, e := range events {
+		ids[i] = e.ID.String()
+	}
+
+	_, err := p.db.ExecContext(ctx, `DELETE FROM `+pq.QuoteIdentifier(table)+` WHERE id = ANY($1::uuid[])`, pq.Array(ids))
+	return err
+}
+
+// appendArchive writes the events as a new gzip member at the end of the
+// file and syncs it. Concatenated members read back as a single stream with
+// gzip -d or gzip.Reader.
+func appendArchive(path string, events []Event) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	encoder := json.NewEncoder(zw)
+	for _, e := range events {
+		if err := encoder.Encode(e); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,52 @@
+package eventlogger
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/lib/pq"
+)
+
+// IsTransient reports whether a failed write is worth retrying: lost
+// connections, the database restarting or running out of resources, and
+// serialization failures
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		code := string(pqErr.Code)
+		switch {
+		case strings.HasPrefix(code, "08"): // connection exception
+			return true
+		case strings.HasPrefix(code, "53"): // insufficient resources
+			return true
+		case code == "40001", code == "40P01": // serialization failure, deadlock
+			return true
+		case code == "57P01", code == "57P02", code == "57P03": // shutting down, cannot connect now
+			return true
+		}
+	}
+
+	return false
+}
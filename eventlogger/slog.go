@@ -0,0 +1,34 @@
+package eventlogger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+)
+
+// slogEventLogger writes each event as a structured JSON line, handy for
+// local development and log shippers
+type slogEventLogger struct {
+	logger *slog.Logger
+}
+
+func NewSlogEventLogger(w io.Writer) *slogEventLogger {
+	return &slogEventLogger{
+		logger: slog.New(slog.NewJSONHandler(w, nil)),
+	}
+}
+
+func (el *slogEventLogger) Save(ctx context.Context, e Event) error {
+	el.logger.LogAttrs(ctx, slog.LevelInfo, "event",
+		slog.String("id", e.ID.String()),
+		slog.String("event_type", e.Type),
+		slog.Any("event_data", e.Data),
+		slog.Any("event_metadata", e.Metadata),
+		slog.Time("created_at", e.CreatedAt),
+	)
+	return nil
+}
+
+func (el *slogEventLogger) GetByType(ctx context.Context, eventType string) ([]Event, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,178 @@
+package eventlogger
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+)
+
+const replayBatchSize = 100
+
+// Spill is an append-only JSON lines file holding events that couldn't be
+// saved, until they can be replayed into an EventLogger
+type Spill struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewSpill(path string) *Spill {
+	return &Spill{path: path}
+}
+
+// Append writes the events to the end of the file and syncs it to disk
+func (s *Spill) Append(events ...Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return appendEvents(s.path, events)
+}
+
+// DeadLetterPath is where events that can never be saved end up, e.g. for
+// breaking a constraint, to be looked at by hand
+func (s *Spill) DeadLetterPath() string {
+	return s.path + ".dead"
+}
+
+func (s *Spill) deadLetter(events ...Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return appendEvents(s.DeadLetterPath(), events)
+}
+
+func appendEvents(path string, events []Event) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+// Pending reports whether there are events waiting to be replayed
+func (s *Spill) Pending() bool {
+	for _, path := range []string{s.path, s.replayPath()} {
+		if info, err := os.Stat(path); err == nil && info.Size() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Replay saves spilled events into the logger and returns how many were
+// saved. The file is moved aside first so new events can keep being appended;
+// whatever fails to save for a transient reason is appended back, events
+// that fail for any other reason go to the dead-letter file so they don't
+// hold back the rest. A replay interrupted by a crash is picked up by the
+// next one, and since events keep their IDs, saving one twice is harmless.
+func (s *Spill) Replay(ctx context.Context, logger EventLogger) (int, error) {
+	s.mu.Lock()
+	if _, err := os.Stat(s.replayPath()); errors.Is(err, fs.ErrNotExist) {
+		if err := os.Rename(s.path, s.replayPath()); err != nil {
+			s.mu.Unlock()
+			if errors.Is(err, fs.ErrNotExist) {
+				return 0, nil
+			}
+			return 0, err
+		}
+	}
+	s.mu.Unlock()
+
+	events, err := readSpill(s.replayPath())
+	if err != nil {
+		return 0, err
+	}
+
+	saved := 0
+	for start := 0; start < len(events); start += replayBatchSize {
+		end := min(start+replayBatchSize, len(events))
+		n, rest, err := s.replayBatch(ctx, logger, events[start:end])
+		saved += n
+		if err != nil {
+			if appendErr := s.Append(slices.Concat(rest, events[end:])...); appendErr != nil {
+				return saved, errors.Join(err, appendErr)
+			}
+			os.Remove(s.replayPath())
+			return saved, err
+		}
+	}
+
+	return saved, os.Remove(s.replayPath())
+}
+
+// replayBatch saves the batch, splitting it in halves when it fails for a
+// reason other than a transient one until the events to blame are found and
+// dead-lettered. On a transient error it stops and also returns the events
+// it didn't get to.
+func (s *Spill) replayBatch(ctx context.Context, logger EventLogger, batch []Event) (int, []Event, error) {
+	err := SaveAll(ctx, logger, batch)
+	if err == nil {
+		return len(batch), nil, nil
+	}
+	if IsTransient(err) || ctx.Err() != nil {
+		return 0, batch, err
+	}
+
+	if len(batch) == 1 {
+		slog.Error("failed to replay spilled event, moving it to the dead-letter file", "event_id", batch[0].ID, "event_type", batch[0].Type, "error", err)
+		if err := s.deadLetter(batch[0]); err != nil {
+			return 0, batch, err
+		}
+		return 0, nil, nil
+	}
+
+	half := len(batch) / 2
+	saved, rest, err := s.replayBatch(ctx, logger, batch[:half])
+	if err != nil {
+		return saved, slices.Concat(rest, batch[half:]), err
+	}
+	n, rest, err := s.replayBatch(ctx, logger, batch[half:])
+	return saved + n, rest, err
+}
+
+func (s *Spill) replayPath() string {
+	return s.path + ".replaying"
+}
+
+func readSpill(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		// a torn last line from a crash mid-write is skipped
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		events = append(events, e)
+	}
+
+	return events, scanner.Err()
+}
@@ -4,6 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type sqlEventLogger struct {
@@ -25,7 +31,8 @@ func (el *sqlEventLogger) Save(ctx context.Context, e Event) error {
 	if err != nil {
 		return err
 	}
-	statement := `INSERT INTO events (id, event_type, event_data, event_metadata, created_at) VALUES ($1, $2, $3, $4, $5)`
+	// the outbox relay may deliver an event more than once, its ID keeps this idempotent
+	statement := `INSERT INTO events (id, event_type, event_data, event_metadata, created_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING`
 	_, err = el.db.ExecContext(ctx, statement, e.ID, e.Type, jsonData, jsonMetadata, e.CreatedAt)
 	if err != nil {
 		return err
@@ -34,6 +41,35 @@ func (el *sqlEventLogger) Save(ctx context.Context, e Event) error {
 	return nil
 }
 
+// SaveBatch inserts all events with a single multi-row statement
+func (el *sqlEventLogger) SaveBatch(ctx context.Context, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(events))
+	args := make([]any, 0, len(events)*5)
+	for _, e := range events {
+		jsonData, err := json.Marshal(e.Data)
+		if err != nil {
+			return err
+		}
+		jsonMetadata, err := json.Marshal(e.Metadata)
+		if err != nil {
+			return err
+		}
+
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
+		args = append(args, e.ID, e.Type, jsonData, jsonMetadata, e.CreatedAt)
+	}
+
+	statement := `INSERT INTO events (id, event_type, event_data, event_metadata, created_at) VALUES ` +
+		strings.Join(values, ", ") + ` ON CONFLICT DO NOTHING`
+	_, err := el.db.ExecContext(ctx, statement, args...)
+	return err
+}
+
 func (el *sqlEventLogger) GetByType(ctx context.Context, eventType string) ([]Event, error) {
 	query := `SELECT id, event_type, event_data, event_metadata, created_at FROM events WHERE event_type = $1`
 	result, err := el.db.QueryContext(ctx, query, eventType)
@@ -44,16 +80,11 @@ func (el *sqlEventLogger) GetByType(ctx context.Context, eventType string) ([]Ev
 
 	events := make([]Event, 0)
 	for result.Next() {
-		var event Event
-		var jsonMetadata []byte
-		if err := result.Scan(&event.ID, &event.Type, &event.Data, &jsonMetadata, &event.CreatedAt); err != nil {
+		event, err := scanEvent(result)
+		if err != nil {
 			return events, err
 		}
-		var metadata map[string]string
-		err = json.Unmarshal(jsonMetadata, &metadata)
-		event.Metadata = metadata
-
-		events = append(events, event)
+		events = append(events, *event)
 	}
 
 	if err := result.Err(); err != nil {
@@ -62,3 +93,229 @@ func (el *sqlEventLogger) GetByType(ctx context.Context, eventType string) ([]Ev
 
 	return events, nil
 }
+
+// Query returns a page of events matching the filter, newest first
+func (el *sqlEventLogger) Query(ctx context.Context, filter Filter) (Page, error) {
+	where, args, err := filterClause(filter)
+	if err != nil {
+		return Page{}, err
+	}
+
+	limit := filter.limit()
+	// one extra row tells whether there's a next page
+	args = append(args, limit+1)
+	query := fmt.Sprintf(`SELECT id, event_type, event_data, event_metadata, created_at, recorded_at 
+              FROM events 
+              %s 
+              ORDER BY created_at DESC, id DESC 
+              LIMIT $%d`, where, len(args))
+
+	result, err := el.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return Page{}, err
+	}
+	defer result.Close()
+
+	page := Page{Events: make([]RecordedEvent, 0, limit)}
+	for result.Next() {
+		event, recordedAt, err := scanRecordedEvent(result)
+		if err != nil {
+			return Page{}, err
+		}
+		page.Events = append(page.Events, RecordedEvent{Event: *event, RecordedAt: recordedAt})
+	}
+	if err := result.Err(); err != nil {
+		return Page{}, err
+	}
+
+	if len(page.Events) > limit {
+		page.Events = page.Events[:limit]
+		page.NextCursor = encodeCursor(page.Events[limit-1].Event)
+	}
+
+	return page, nil
+}
+
+func (el *sqlEventLogger) QueryRecorded(ctx context.Context, filter Filter, after Position) ([]RecordedEvent, error) {
+	filter.Cursor = ""
+	where, args, err := filterClause(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	args = append(args, after.RecordedAt, after.ID)
+	condition := fmt.Sprintf("(recorded_at, id) > ($%d, $%d)", len(args)-1, len(args))
+	if where == "" {
+		where = "WHERE " + condition
+	} else {
+		where += " AND " + condition
+	}
+
+	args = append(args, filter.limit())
+	query := fmt.Sprintf(`SELECT id, event_type, event_data, event_metadata, created_at, recorded_at 
+              FROM events 
+              %s 
+              ORDER BY recorded_at, id 
+              LIMIT $%d`, where, len(args))
+
+	result, err := el.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var events []RecordedEvent
+	for result.Next() {
+		event, recordedAt, err := scanRecordedEvent(result)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, RecordedEvent{Event: *event, RecordedAt: recordedAt})
+	}
+
+	return events, result.Err()
+}
+
+func (el *sqlEventLogger) GetByID(ctx context.Context, id uuid.UUID) (*Event, error) {
+	query := `SELECT id, event_type, event_data, event_metadata, created_at FROM events WHERE id = $1`
+
+	event, err := scanEvent(el.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// Count returns how many events match the filter, ignoring limit and cursor
+func (el *sqlEventLogger) Count(ctx context.Context, filter Filter) (int64, error) {
+	filter.Cursor = ""
+	where, args, err := filterClause(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	err = el.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM events `+where, args...).Scan(&count)
+	return count, err
+}
+
+// CountByType aggregates matching events per type, most frequent first
+func (el *sqlEventLogger) CountByType(ctx context.Context, filter Filter) ([]TypeCount, error) {
+	filter.Cursor = ""
+	where, args, err := filterClause(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT event_type, COUNT(*) FROM events ` + where + ` GROUP BY event_type ORDER BY COUNT(*) DESC, event_type`
+	result, err := el.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var counts []TypeCount
+	for result.Next() {
+		var count TypeCount
+		if err := result.Scan(&count.Type, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, result.Err()
+}
+
+// filterClause builds the WHERE clause for a filter. Type and time conditions
+// come first so idx_events_type_created_at can serve them.
+func filterClause(filter Filter) (string, []any, error) {
+	var conditions []string
+	var args []any
+
+	if len(filter.Types) > 0 {
+		args = append(args, pq.Array(filter.Types))
+		conditions = append(conditions, fmt.Sprintf("event_type = ANY($%d)", len(args)))
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	if len(filter.Metadata) > 0 {
+		jsonMetadata, err := json.Marshal(filter.Metadata)
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, jsonMetadata)
+		conditions = append(conditions, fmt.Sprintf("event_metadata @> $%d::jsonb", len(args)))
+	}
+	if filter.LedgerID != uuid.Nil {
+		args = append(args, filter.LedgerID.String())
+		conditions = append(conditions, fmt.Sprintf("(event_metadata->>'ledger_id' = $%d OR event_data->>'ledger_id' = $%d)", len(args), len(args)))
+	}
+	if filter.UserID != uuid.Nil {
+		args = append(args, filter.UserID.String())
+		conditions = append(conditions, fmt.Sprintf("(event_metadata->>'user_id' = $%d OR event_data->>'user_id' = $%d)", len(args), len(args)))
+	}
+	if filter.Cursor != "" {
+		c, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, c.CreatedAt, c.ID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args, nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanEvent(row scanner) (*Event, error) {
+	var event Event
+	var jsonData, jsonMetadata []byte
+	if err := row.Scan(&event.ID, &event.Type, &jsonData, &jsonMetadata, &event.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	data, err := decodeJSONData(jsonData)
+	if err != nil {
+		return nil, err
+	}
+	event.Data = data
+
+	if len(jsonMetadata) > 0 {
+		if err := json.Unmarshal(jsonMetadata, &event.Metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	return &event, nil
+}
+
+// scanRecordedEvent scans an event followed by its recorded_at column
+func scanRecordedEvent(row scanner) (*Event, time.Time, error) {
+	var recordedAt time.Time
+	event, err := scanEvent(scanFunc(func(dest ...any) error {
+		return row.Scan(append(dest, &recordedAt)...)
+	}))
+	return event, recordedAt, err
+}
+
+type scanFunc func(dest ...any) error
+
+func (f scanFunc) Scan(dest ...any) error {
+	return f(dest...)
+}
@@ -4,58 +4,276 @@ import (
 	"context"
 	"log/slog"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Worker struct {
-	eventCh chan Event
-	logger  EventLogger
-	wg      sync.WaitGroup
-	ctx     context.Context
-	cancel  context.CancelFunc
+	eventCh       chan Event
+	logger        EventLogger
+	batchSize     int
+	flushInterval time.Duration
+	consumers     int
+	maxAttempts   int
+	retryDelay    time.Duration
+	spill         *Spill
+	replayEvery   time.Duration
+	replayCh      chan struct{}
+	enqueued      atomic.Int64
+	saved         atomic.Int64
+	dropped       atomic.Int64
+	failed        atomic.Int64
+	spilled       atomic.Int64
+	replayed      atomic.Int64
+	rejected      atomic.Int64
+	wg            sync.WaitGroup
+	ctx           context.Context
+	cancel        context.CancelFunc
 }
 
-func NewWorker(logger EventLogger, bufferSize int) *Worker {
+// WorkerStats are running totals since the worker was created
+type WorkerStats struct {
+	Enqueued int64 `json:"enqueued"`
+	Saved    int64 `json:"saved"`
+	Dropped  int64 `json:"dropped"`
+	Failed   int64 `json:"failed"`
+	Spilled  int64 `json:"spilled"`
+	Replayed int64 `json:"replayed"`
+	Rejected int64 `json:"rejected"`
+	Buffered int   `json:"buffered"`
+}
+
+type WorkerOption func(*Worker)
+
+// WithBatchSize saves events in batches of up to n. Defaults to 1, one
+// insert per event.
+func WithBatchSize(n int) WorkerOption {
+	return func(w *Worker) {
+		w.batchSize = max(n, 1)
+	}
+}
+
+// WithFlushInterval saves a partial batch once it's been waiting for d
+func WithFlushInterval(d time.Duration) WorkerOption {
+	return func(w *Worker) {
+		w.flushInterval = d
+	}
+}
+
+// WithConsumers sets how many goroutines save events concurrently
+func WithConsumers(n int) WorkerOption {
+	return func(w *Worker) {
+		w.consumers = max(n, 1)
+	}
+}
+
+// WithRetry retries transient save failures up to maxAttempts times in
+// total, doubling delay between attempts
+func WithRetry(maxAttempts int, delay time.Duration) WorkerOption {
+	return func(w *Worker) {
+		w.maxAttempts = max(maxAttempts, 1)
+		w.retryDelay = delay
+	}
+}
+
+// WithSpill writes events that can't be saved, or don't fit in the buffer,
+// to the spill file. They're replayed at startup, every replayEvery, and as
+// soon as a save succeeds again.
+func WithSpill(spill *Spill, replayEvery time.Duration) WorkerOption {
+	return func(w *Worker) {
+		w.spill = spill
+		w.replayEvery = replayEvery
+	}
+}
+
+func NewWorker(logger EventLogger, bufferSize int, opts ...WorkerOption) *Worker {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Worker{
-		eventCh: make(chan Event, bufferSize),
-		logger:  logger,
-		ctx:     ctx,
-		cancel:  cancel,
+	w := &Worker{
+		eventCh:       make(chan Event, bufferSize),
+		logger:        logger,
+		batchSize:     1,
+		flushInterval: time.Second,
+		consumers:     1,
+		maxAttempts:   1,
+		replayCh:      make(chan struct{}, 1),
+		ctx:           ctx,
+		cancel:        cancel,
 	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
 }
 
 func (w *Worker) Start() {
-	w.wg.Go(func() {
-		for {
-			select {
-			case <-w.ctx.Done():
-				slog.Info("draining events before shutdown", "remaining_events", len(w.eventCh))
-				for len(w.eventCh) > 0 {
-					event := <-w.eventCh
-					if err := w.logger.Save(context.Background(), event); err != nil {
-						slog.Error("failed to save event during shutdown", "error", err, "event_type", event.Type)
+	for range w.consumers {
+		w.wg.Go(w.consume)
+	}
+	if w.spill != nil {
+		w.wg.Go(w.replay)
+	}
+}
+
+// replay feeds spilled events back into the logger at startup, periodically
+// and whenever a consumer signals the database is reachable again
+func (w *Worker) replay() {
+	ticker := time.NewTicker(w.replayEvery)
+	defer ticker.Stop()
+
+	for {
+		if w.spill.Pending() {
+			n, err := w.spill.Replay(w.ctx, w.logger)
+			w.replayed.Add(int64(n))
+			if err != nil {
+				slog.Warn("failed to replay spilled events", "error", err, "replayed", n)
+			} else if n > 0 {
+				slog.Info("replayed spilled events", "replayed", n)
+			}
+		}
+
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.replayCh:
+		}
+	}
+}
+
+func (w *Worker) consume() {
+	batch := make([]Event, 0, w.batchSize)
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			slog.Info("draining events before shutdown", "remaining_events", len(w.eventCh))
+			for {
+				select {
+				case event := <-w.eventCh:
+					batch = append(batch, event)
+					if len(batch) >= w.batchSize {
+						batch = w.flush(context.Background(), batch)
 					}
+				default:
+					w.flush(context.Background(), batch)
+					return
 				}
-				return
-			case event := <-w.eventCh:
-				if err := w.logger.Save(w.ctx, event); err != nil {
-					slog.Error("failed to save event", "error", err, "event_type", event.Type)
-				}
 			}
+		case event := <-w.eventCh:
+			batch = append(batch, event)
+			if len(batch) >= w.batchSize {
+				batch = w.flush(w.ctx, batch)
+			}
+		case <-ticker.C:
+			batch = w.flush(w.ctx, batch)
+		}
+	}
+}
+
+// flush saves the batch and returns it emptied for reuse
+func (w *Worker) flush(ctx context.Context, batch []Event) []Event {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	if err := w.save(ctx, batch); err != nil {
+		w.failed.Add(int64(len(batch)))
+		slog.Error("failed to save events", "error", err, "count", len(batch), "event_type", batch[0].Type)
+		w.spillEvents(batch...)
+		return batch[:0]
+	}
+
+	w.saved.Add(int64(len(batch)))
+	if w.spill != nil && w.spill.Pending() {
+		// the database is back, don't wait for the next tick to replay
+		select {
+		case w.replayCh <- struct{}{}:
+		default:
+		}
+	}
+
+	return batch[:0]
+}
+
+// save retries transient failures with exponential backoff
+func (w *Worker) save(ctx context.Context, batch []Event) error {
+	delay := w.retryDelay
+	for attempt := 1; ; attempt++ {
+		err := SaveAll(ctx, w.logger, batch)
+		if err == nil || attempt >= w.maxAttempts || !IsTransient(err) {
+			return err
+		}
+
+		slog.Warn("retrying event save", "error", err, "attempt", attempt, "delay", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
 		}
-	})
+		delay *= 2
+	}
+}
+
+// spillEvents writes events to the spill file, if there is one, and reports
+// whether they were kept
+func (w *Worker) spillEvents(events ...Event) bool {
+	if w.spill == nil {
+		return false
+	}
+
+	if err := w.spill.Append(events...); err != nil {
+		slog.Error("failed to spill events, they are lost", "error", err, "count", len(events))
+		return false
+	}
+	w.spilled.Add(int64(len(events)))
+	return true
 }
 
+// Log validates the event against its registered schema and enqueues it
+// without blocking. It's fire-and-forget: invalid events are logged, counted
+// as rejected and discarded; when the buffer is full the event goes to the
+// spill file, or is counted as dropped if there's none.
 func (w *Worker) Log(event Event) {
+	if err := w.validate(event); err != nil {
+		return
+	}
+
 	select {
 	case w.eventCh <- event:
-		// Event sent successfully
+		w.enqueued.Add(1)
 	default:
-		// Channel is full, log the error
+		if w.spillEvents(event) {
+			return
+		}
+		w.dropped.Add(1)
 		slog.Warn("event channel full, dropping event", "event_type", event.Type)
 	}
 }
 
+func (w *Worker) validate(event Event) error {
+	if err := Validate(event); err != nil {
+		w.rejected.Add(1)
+		slog.Error("rejecting invalid event", "error", err, "event_type", event.Type)
+		return err
+	}
+	return nil
+}
+
+func (w *Worker) Stats() WorkerStats {
+	return WorkerStats{
+		Enqueued: w.enqueued.Load(),
+		Saved:    w.saved.Load(),
+		Dropped:  w.dropped.Load(),
+		Failed:   w.failed.Load(),
+		Spilled:  w.spilled.Load(),
+		Replayed: w.replayed.Load(),
+		Rejected: w.rejected.Load(),
+		Buffered: len(w.eventCh),
+	}
+}
+
 func (w *Worker) EventChannel() chan<- Event {
 	return w.eventCh
 }
@@ -12,3 +12,5 @@ require (
 )
 
 require golang.org/x/crypto v0.46.0
+
+require rsc.io/qr v0.2.0
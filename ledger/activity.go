@@ -0,0 +1,43 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/billbatista/acasinha-expenses/eventlogger"
+)
+
+// ActivityTypes are the events shown in a ledger's activity feed
+var ActivityTypes = []string{
+	eventlogger.LedgerCreated{}.EventType(),
+	eventlogger.LedgerMemberAdded{}.EventType(),
+	eventlogger.ExpenseCreated{}.EventType(),
+	eventlogger.SettlementCreated{}.EventType(),
+}
+
+// GetActivityReadAt returns when the user last saw the ledger's activity,
+// the zero time if never
+func (r *repository) GetActivityReadAt(ctx context.Context, ledgerID string, userID string) (time.Time, error) {
+	query := `SELECT last_read_at FROM ledger_activity_reads WHERE ledger_id = $1 AND user_id = $2`
+
+	var readAt time.Time
+	err := r.db.QueryRowContext(ctx, query, ledgerID, userID).Scan(&readAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return readAt, err
+}
+
+// MarkActivityRead records the user has seen the activity up to at. It never
+// moves backwards, so viewing an older page doesn't bring back markers.
+func (r *repository) MarkActivityRead(ctx context.Context, ledgerID string, userID string, at time.Time) error {
+	query := `INSERT INTO ledger_activity_reads (ledger_id, user_id, last_read_at) 
+              VALUES ($1, $2, $3) 
+              ON CONFLICT (ledger_id, user_id) 
+              DO UPDATE SET last_read_at = GREATEST(ledger_activity_reads.last_read_at, EXCLUDED.last_read_at)`
+
+	_, err := r.db.ExecContext(ctx, query, ledgerID, userID, at)
+	return err
+}
@@ -1,6 +1,7 @@
 package ledger
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -45,11 +46,29 @@ type LedgerUser struct {
 	JoinedAt time.Time `json:"joined_at,omitempty"`
 }
 
+// Settlement records a payment between two members that pays down a balance
+type Settlement struct {
+	ID        uuid.UUID `json:"id,omitempty"`
+	LedgerID  uuid.UUID `json:"ledger_id,omitempty"`
+	FromUser  uuid.UUID `json:"from_user,omitempty"`
+	ToUser    uuid.UUID `json:"to_user,omitempty"`
+	Amount    int64     `json:"amount,omitempty"` // Amount in cents
+	CreatedAt time.Time `json:"created_at,omitempty"`
+}
+
+// ExpenseFilter narrows down expense listings. A zero Limit means no limit.
+type ExpenseFilter struct {
+	Limit    int
+	Offset   int
+	Category string
+	PaidBy   uuid.UUID
+}
+
 // Balance represents a user's net balance in a ledger
 // Calculated on-the-fly from expenses
 type Balance struct {
-	UserID uuid.UUID
-	Amount int64 // Positive = owed money, Negative = owes money
+	UserID uuid.UUID `json:"user_id"`
+	Amount int64     `json:"amount"` // Positive = owed money, Negative = owes money
 }
 
 var (
@@ -57,8 +76,35 @@ var (
 	ErrEmptyCurrency    = errors.New("currency can't be empty")
 	ErrInvalidAmount    = errors.New("amount must be positive")
 	ErrEmptyDescription = errors.New("description can't be empty")
+	ErrSelfSettlement   = errors.New("can't settle with yourself")
+	ErrNotMember        = errors.New("user is not a member of the ledger")
+	ErrAlreadyMember    = errors.New("user is already a member of the ledger")
+	ErrNameTaken        = errors.New("a ledger with this name already exists")
+	ErrLedgerNotFound   = errors.New("ledger doesn't exist")
+	ErrUnknownUser      = errors.New("user doesn't exist")
 )
 
+type Repository interface {
+	CreateNew(ctx context.Context, ledger Ledger) (string, error)
+	SaveExpense(ctx context.Context, expense Expense, splits []ExpenseSplit) error
+	SaveSettlement(ctx context.Context, settlement Settlement) error
+	AddMember(ctx context.Context, ledgerID string, userID string) error
+	IsMember(ctx context.Context, ledgerID string, userID string) (bool, error)
+	GetLedgerByID(ctx context.Context, ledgerID string) (*Ledger, error)
+	GetUserLedgers(ctx context.Context, userID string, limit, offset int) ([]Ledger, error)
+	GetUserFirstLedger(ctx context.Context, userID string) (*Ledger, error)
+	GetLedgerMembers(ctx context.Context, ledgerID string) ([]LedgerUser, error)
+	GetRecentExpenses(ctx context.Context, ledgerID string, limit int) ([]Expense, error)
+	GetExpenses(ctx context.Context, ledgerID string, filter ExpenseFilter) ([]Expense, error)
+	GetExpenseByID(ctx context.Context, expenseID string) (*Expense, error)
+	GetExpenseSplits(ctx context.Context, ledgerID string) ([]ExpenseSplit, error)
+	GetSplitsByExpense(ctx context.Context, expenseID string) ([]ExpenseSplit, error)
+	GetSettlements(ctx context.Context, ledgerID string, limit, offset int) ([]Settlement, error)
+	GetDailySpending(ctx context.Context, ledgerID string, from, to time.Time) ([]DailySpending, error)
+	GetActivityReadAt(ctx context.Context, ledgerID string, userID string) (time.Time, error)
+	MarkActivityRead(ctx context.Context, ledgerID string, userID string, at time.Time) error
+}
+
 func NewLedger(name string, currency string, createdBy uuid.UUID) (Ledger, error) {
 	if name == "" {
 		return Ledger{}, ErrEmptyName
@@ -107,6 +153,25 @@ func NewExpense(ledgerID uuid.UUID, description string, amount int64, paidBy uui
 	return expense, splits, nil
 }
 
+func NewSettlement(ledgerID uuid.UUID, from uuid.UUID, to uuid.UUID, amount int64) (*Settlement, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	if from == to {
+		return nil, ErrSelfSettlement
+	}
+
+	return &Settlement{
+		ID:        uuid.New(),
+		LedgerID:  ledgerID,
+		FromUser:  from,
+		ToUser:    to,
+		Amount:    amount,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
 func CalculateSplits(expenseID uuid.UUID, amount int64, splitType SplitType, memberIDs []uuid.UUID) ([]ExpenseSplit, error) {
 	numMembers := int64(len(memberIDs))
 	if numMembers == 0 {
@@ -139,8 +204,8 @@ func CalculateSplits(expenseID uuid.UUID, amount int64, splitType SplitType, mem
 	}
 }
 
-// CalculateBalances computes net balances for all users from expenses and their splits
-func CalculateBalances(expenses []Expense, splits []ExpenseSplit, memberIDs []uuid.UUID) map[uuid.UUID]int64 {
+// CalculateBalances computes net balances for all users from expenses, their splits and settlements
+func CalculateBalances(expenses []Expense, splits []ExpenseSplit, settlements []Settlement, memberIDs []uuid.UUID) map[uuid.UUID]int64 {
 	balances := make(map[uuid.UUID]int64)
 
 	// Initialize all members with 0 balance
@@ -158,5 +223,11 @@ func CalculateBalances(expenses []Expense, splits []ExpenseSplit, memberIDs []uu
 		balances[split.UserID] -= split.Amount
 	}
 
+	// A settlement moves money from debtor to creditor
+	for _, settlement := range settlements {
+		balances[settlement.FromUser] += settlement.Amount
+		balances[settlement.ToUser] -= settlement.Amount
+	}
+
 	return balances
 }
@@ -3,8 +3,27 @@ package ledger
 import (
 	"context"
 	"database/sql"
+	"fmt"
+
+	"github.com/billbatista/acasinha-expenses/dberr"
+	"github.com/billbatista/acasinha-expenses/eventlogger"
+	"github.com/google/uuid"
 )
 
+// constraints maps the ledger tables constraints to their domain errors
+var constraints = dberr.Constraints{
+	"ledger_name_unique":                 ErrNameTaken,
+	"ledgers_created_by_fkey":            ErrUnknownUser,
+	"ledger_users_ledger_id_fkey":        ErrLedgerNotFound,
+	"ledger_users_user_id_fkey":          ErrUnknownUser,
+	"ledger_expenses_ledger_id_fkey":     ErrLedgerNotFound,
+	"ledger_expenses_paid_by_fkey":       ErrUnknownUser,
+	"ledger_expense_splits_user_id_fkey": ErrUnknownUser,
+	"ledger_settlements_ledger_id_fkey":  ErrLedgerNotFound,
+	"ledger_settlements_from_user_fkey":  ErrUnknownUser,
+	"ledger_settlements_to_user_fkey":    ErrUnknownUser,
+}
+
 type repository struct {
 	db *sql.DB
 }
@@ -32,12 +51,24 @@ func (r *repository) CreateNew(ctx context.Context, ledger Ledger) (string, erro
 		ledger.CreatedAt,
 	).Scan(&lastId)
 	if err != nil {
-		return lastId, err
+		return lastId, constraints.Translate(err)
 	}
 
 	insertLedgerUser := `INSERT INTO ledger_users (ledger_id, user_id) VALUES ($1, $2)`
 	_, err = tx.ExecContext(ctx, insertLedgerUser, ledger.ID, ledger.CreatedBy)
 	if err != nil {
+		return lastId, constraints.Translate(err)
+	}
+
+	evt := eventlogger.NewEventContext(ctx,
+		eventlogger.WithPayload(eventlogger.LedgerCreated{
+			LedgerID: ledger.ID,
+			UserID:   ledger.CreatedBy,
+			Name:     ledger.Name,
+			Currency: ledger.Currency,
+		}),
+	)
+	if err := eventlogger.AddToOutbox(ctx, tx, evt); err != nil {
 		return lastId, err
 	}
 
@@ -65,17 +96,31 @@ func (r *repository) SaveExpense(ctx context.Context, expense Expense, splits []
 		expense.CreatedAt,
 	)
 	if err != nil {
-		return err
+		return constraints.Translate(err)
 	}
 
 	for _, split := range splits {
 		query = `INSERT INTO ledger_expense_splits (expense_id, user_id, amount) VALUES ($1, $2, $3)`
 		_, err = tx.ExecContext(ctx, query, split.ExpenseID, split.UserID, split.Amount)
 		if err != nil {
-			return err
+			return constraints.Translate(err)
 		}
 	}
 
+	evt := eventlogger.NewEventContext(ctx,
+		eventlogger.WithPayload(eventlogger.ExpenseCreated{
+			LedgerID:    expense.LedgerID,
+			ExpenseID:   expense.ID,
+			PaidBy:      expense.PaidBy,
+			Description: expense.Description,
+			Category:    expense.Category,
+			Amount:      expense.Amount,
+		}),
+	)
+	if err := eventlogger.AddToOutbox(ctx, tx, evt); err != nil {
+		return err
+	}
+
 	return tx.Commit()
 }
 
@@ -123,13 +168,36 @@ func (r *repository) GetLedgerMembers(ctx context.Context, ledgerID string) ([]L
 }
 
 func (r *repository) GetRecentExpenses(ctx context.Context, ledgerID string, limit int) ([]Expense, error) {
+	return r.GetExpenses(ctx, ledgerID, ExpenseFilter{Limit: limit})
+}
+
+func (r *repository) GetExpenses(ctx context.Context, ledgerID string, filter ExpenseFilter) ([]Expense, error) {
 	query := `SELECT id, ledger_id, description, amount, paid_by, split_type, category, created_at 
               FROM ledger_expenses 
-              WHERE ledger_id = $1 
-              ORDER BY created_at DESC 
-              LIMIT $2`
+              WHERE ledger_id = $1`
+	args := []any{ledgerID}
+
+	if filter.Category != "" {
+		args = append(args, filter.Category)
+		query += fmt.Sprintf(" AND category = $%d", len(args))
+	}
+	if filter.PaidBy != uuid.Nil {
+		args = append(args, filter.PaidBy)
+		query += fmt.Sprintf(" AND paid_by = $%d", len(args))
+	}
+
+	query += " ORDER BY created_at DESC"
 
-	rows, err := r.db.QueryContext(ctx, query, ledgerID, limit)
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -137,30 +205,59 @@ func (r *repository) GetRecentExpenses(ctx context.Context, ledgerID string, lim
 
 	var expenses []Expense
 	for rows.Next() {
-		var expense Expense
-		var category sql.NullString
-		err := rows.Scan(
-			&expense.ID,
-			&expense.LedgerID,
-			&expense.Description,
-			&expense.Amount,
-			&expense.PaidBy,
-			&expense.SplitType,
-			&category,
-			&expense.CreatedAt,
-		)
+		expense, err := scanExpense(rows)
 		if err != nil {
 			return nil, err
 		}
-		if category.Valid {
-			expense.Category = category.String
-		}
-		expenses = append(expenses, expense)
+		expenses = append(expenses, *expense)
 	}
 
 	return expenses, rows.Err()
 }
 
+func (r *repository) GetExpenseByID(ctx context.Context, expenseID string) (*Expense, error) {
+	query := `SELECT id, ledger_id, description, amount, paid_by, split_type, category, created_at 
+              FROM ledger_expenses 
+              WHERE id = $1`
+
+	expense, err := scanExpense(r.db.QueryRowContext(ctx, query, expenseID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return expense, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanExpense(row scanner) (*Expense, error) {
+	var expense Expense
+	var category sql.NullString
+	err := row.Scan(
+		&expense.ID,
+		&expense.LedgerID,
+		&expense.Description,
+		&expense.Amount,
+		&expense.PaidBy,
+		&expense.SplitType,
+		&category,
+		&expense.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if category.Valid {
+		expense.Category = category.String
+	}
+
+	return &expense, nil
+}
+
 func (r *repository) GetExpenseSplits(ctx context.Context, ledgerID string) ([]ExpenseSplit, error) {
 	query := `SELECT es.expense_id, es.user_id, es.amount 
               FROM ledger_expense_splits es
@@ -211,3 +308,180 @@ func (r *repository) GetUserFirstLedger(ctx context.Context, userID string) (*Le
 
 	return &ledger, nil
 }
+
+func (r *repository) GetUserLedgers(ctx context.Context, userID string, limit, offset int) ([]Ledger, error) {
+	query := `SELECT l.id, l.name, l.currency, l.created_by, l.created_at 
+              FROM ledgers l
+              INNER JOIN ledger_users lu ON l.id = lu.ledger_id
+              WHERE lu.user_id = $1
+              ORDER BY l.created_at ASC
+              LIMIT $2 OFFSET $3`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ledgers []Ledger
+	for rows.Next() {
+		var ledger Ledger
+		err := rows.Scan(&ledger.ID, &ledger.Name, &ledger.Currency, &ledger.CreatedBy, &ledger.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ledgers = append(ledgers, ledger)
+	}
+
+	return ledgers, rows.Err()
+}
+
+func (r *repository) AddMember(ctx context.Context, ledgerID string, userID string) error {
+	ledgerUUID, err := uuid.Parse(ledgerID)
+	if err != nil {
+		return err
+	}
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO ledger_users (ledger_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	result, err := tx.ExecContext(ctx, query, ledgerID, userID)
+	if err != nil {
+		return constraints.Translate(err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrAlreadyMember
+	}
+
+	evt := eventlogger.NewEventContext(ctx,
+		eventlogger.WithPayload(eventlogger.LedgerMemberAdded{
+			LedgerID: ledgerUUID,
+			UserID:   userUUID,
+		}),
+	)
+	if err := eventlogger.AddToOutbox(ctx, tx, evt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *repository) IsMember(ctx context.Context, ledgerID string, userID string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM ledger_users WHERE ledger_id = $1 AND user_id = $2)`
+
+	var exists bool
+	err := r.db.QueryRowContext(ctx, query, ledgerID, userID).Scan(&exists)
+	return exists, err
+}
+
+func (r *repository) GetSplitsByExpense(ctx context.Context, expenseID string) ([]ExpenseSplit, error) {
+	query := `SELECT expense_id, user_id, amount FROM ledger_expense_splits WHERE expense_id = $1`
+
+	rows, err := r.db.QueryContext(ctx, query, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var splits []ExpenseSplit
+	for rows.Next() {
+		var split ExpenseSplit
+		err := rows.Scan(&split.ExpenseID, &split.UserID, &split.Amount)
+		if err != nil {
+			return nil, err
+		}
+		splits = append(splits, split)
+	}
+
+	return splits, rows.Err()
+}
+
+func (r *repository) SaveSettlement(ctx context.Context, settlement Settlement) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO ledger_settlements (id, ledger_id, from_user, to_user, amount, created_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = tx.ExecContext(
+		ctx,
+		query,
+		settlement.ID,
+		settlement.LedgerID,
+		settlement.FromUser,
+		settlement.ToUser,
+		settlement.Amount,
+		settlement.CreatedAt,
+	)
+	if err != nil {
+		return constraints.Translate(err)
+	}
+
+	evt := eventlogger.NewEventContext(ctx,
+		eventlogger.WithPayload(eventlogger.SettlementCreated{
+			LedgerID:     settlement.LedgerID,
+			SettlementID: settlement.ID,
+			FromUser:     settlement.FromUser,
+			ToUser:       settlement.ToUser,
+			Amount:       settlement.Amount,
+		}),
+	)
+	if err := eventlogger.AddToOutbox(ctx, tx, evt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetSettlements lists settlements newest first. A zero limit means no limit.
+func (r *repository) GetSettlements(ctx context.Context, ledgerID string, limit, offset int) ([]Settlement, error) {
+	query := `SELECT id, ledger_id, from_user, to_user, amount, created_at 
+              FROM ledger_settlements 
+              WHERE ledger_id = $1 
+              ORDER BY created_at DESC 
+              LIMIT $2 OFFSET $3`
+
+	var limitArg any
+	if limit > 0 {
+		limitArg = limit
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, ledgerID, limitArg, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var settlements []Settlement
+	for rows.Next() {
+		var settlement Settlement
+		err := rows.Scan(
+			&settlement.ID,
+			&settlement.LedgerID,
+			&settlement.FromUser,
+			&settlement.ToUser,
+			&settlement.Amount,
+			&settlement.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		settlements = append(settlements, settlement)
+	}
+
+	return settlements, rows.Err()
+}
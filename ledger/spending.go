@@ -0,0 +1,84 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/billbatista/acasinha-expenses/eventlogger"
+	"github.com/google/uuid"
+)
+
+// DailySpending is the total spent in a ledger on one day and category,
+// projected from expense.created events
+type DailySpending struct {
+	LedgerID     uuid.UUID `json:"ledger_id"`
+	Day          time.Time `json:"day"`
+	Category     string    `json:"category"`
+	Total        int64     `json:"total"`
+	ExpenseCount int       `json:"expense_count"`
+}
+
+type dailySpendingProjection struct {
+	loc *time.Location
+}
+
+// NewDailySpendingProjection sums expenses per ledger, category and day,
+// with days starting at midnight in loc
+func NewDailySpendingProjection(loc *time.Location) eventlogger.Projection {
+	return &dailySpendingProjection{loc: loc}
+}
+
+func (p *dailySpendingProjection) Name() string {
+	return "ledger_daily_spending"
+}
+
+func (p *dailySpendingProjection) Types() []string {
+	return []string{eventlogger.ExpenseCreated{}.EventType()}
+}
+
+func (p *dailySpendingProjection) Apply(ctx context.Context, tx *sql.Tx, e eventlogger.Event) error {
+	expense, err := eventlogger.Decode[eventlogger.ExpenseCreated](e)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO ledger_daily_spending (ledger_id, day, category, total, expense_count) 
+              VALUES ($1, $2, $3, $4, 1) 
+              ON CONFLICT (ledger_id, day, category) 
+              DO UPDATE SET total = ledger_daily_spending.total + EXCLUDED.total, 
+                            expense_count = ledger_daily_spending.expense_count + 1`
+	_, err = tx.ExecContext(ctx, query, expense.LedgerID, e.CreatedAt.In(p.loc).Format(time.DateOnly), expense.Category, expense.Amount)
+	return err
+}
+
+func (p *dailySpendingProjection) Reset(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM ledger_daily_spending`)
+	return err
+}
+
+// GetDailySpending returns the ledger totals between from and to, both
+// inclusive, oldest day first
+func (r *repository) GetDailySpending(ctx context.Context, ledgerID string, from, to time.Time) ([]DailySpending, error) {
+	query := `SELECT ledger_id, day, category, total, expense_count 
+              FROM ledger_daily_spending 
+              WHERE ledger_id = $1 AND day BETWEEN $2 AND $3 
+              ORDER BY day, category`
+
+	rows, err := r.db.QueryContext(ctx, query, ledgerID, from.Format(time.DateOnly), to.Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var spending []DailySpending
+	for rows.Next() {
+		var s DailySpending
+		if err := rows.Scan(&s.LedgerID, &s.Day, &s.Category, &s.Total, &s.ExpenseCount); err != nil {
+			return nil, err
+		}
+		spending = append(spending, s)
+	}
+
+	return spending, rows.Err()
+}
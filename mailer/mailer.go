@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+)
+
+var (
+	ErrNoRecipient   = errors.New("message has no recipient")
+	ErrInvalidHeader = errors.New("recipient and subject can't contain line breaks")
+)
+
+type Message struct {
+	To      string
+	Subject string
+	// Body is sent as plain text
+	Body string
+}
+
+// validate rejects messages that could inject extra headers
+func (m Message) validate() error {
+	if m.To == "" {
+		return ErrNoRecipient
+	}
+	if strings.ContainsAny(m.To+m.Subject, "\r\n") {
+		return ErrInvalidHeader
+	}
+	return nil
+}
+
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// logSender writes messages to the log instead of sending them, for
+// development without a mail server
+type logSender struct{}
+
+func NewLogSender() *logSender {
+	return &logSender{}
+}
+
+func (s *logSender) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "email not sent, logging it instead", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
@@ -0,0 +1,146 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// received is what the fake server got in one session
+type received struct {
+	from string
+	to   []string
+	data []byte
+}
+
+// fakeSMTPServer accepts a single session on a loopback socket, answering
+// just enough of SMTP for the sender, and hands over what it received
+func fakeSMTPServer(t *testing.T) (string, <-chan received) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	done := make(chan received, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		text := textproto.NewConn(conn)
+		var got received
+		text.PrintfLine("220 localhost fake ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO", "HELO":
+				text.PrintfLine("250-localhost")
+				text.PrintfLine("250 8BITMIME")
+			case "MAIL":
+				got.from = pathArg(arg)
+				text.PrintfLine("250 OK")
+			case "RCPT":
+				got.to = append(got.to, pathArg(arg))
+				text.PrintfLine("250 OK")
+			case "DATA":
+				text.PrintfLine("354 Go ahead")
+				got.data, err = text.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				text.PrintfLine("250 OK")
+			case "QUIT":
+				text.PrintfLine("221 Bye")
+				done <- got
+				return
+			default:
+				text.PrintfLine("502 Not implemented")
+			}
+		}
+	}()
+
+	return ln.Addr().String(), done
+}
+
+// pathArg takes the address out of "FROM:<a@b> BODY=8BITMIME" or "TO:<a@b>"
+func pathArg(arg string) string {
+	_, path, _ := strings.Cut(arg, "<")
+	address, _, _ := strings.Cut(path, ">")
+	return address
+}
+
+func TestSMTPSenderSend(t *testing.T) {
+	addr, done := fakeSMTPServer(t)
+
+	sender := NewSMTPSender(addr, "Despesas <no-reply@example.com>", "", "")
+	err := sender.Send(context.Background(), Message{
+		To:      "ana@example.com",
+		Subject: "Redefinição de senha",
+		Body:    "Olá!\nUse o link abaixo.\n",
+	})
+	if err != nil {
+		t.Fatalf("Send() = %v", err)
+	}
+
+	got := <-done
+	if got.from != "no-reply@example.com" {
+		t.Errorf("MAIL FROM = %q, want the bare sender address", got.from)
+	}
+	if len(got.to) != 1 || got.to[0] != "ana@example.com" {
+		t.Errorf("RCPT TO = %q, want [ana@example.com]", got.to)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(got.data))
+	if err != nil {
+		t.Fatalf("reading the message: %v", err)
+	}
+	if from := msg.Header.Get("From"); from != "Despesas <no-reply@example.com>" {
+		t.Errorf("From = %q", from)
+	}
+	if to := msg.Header.Get("To"); to != "ana@example.com" {
+		t.Errorf("To = %q", to)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Redefinição de senha" {
+		t.Errorf("Subject decodes to %q (%v)", subject, err)
+	}
+	if id := msg.Header.Get("Message-ID"); !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID = %q, want it on the sender's domain", id)
+	}
+	if ct := msg.Header.Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	body, _ := io.ReadAll(msg.Body)
+	if string(body) != "Olá!\nUse o link abaixo.\n" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestSMTPSenderRejectsHeaderInjection(t *testing.T) {
+	// nothing listens here, the message must be rejected before dialing
+	sender := NewSMTPSender("127.0.0.1:1", "no-reply@example.com", "", "")
+
+	err := sender.Send(context.Background(), Message{
+		To:      "ana@example.com\r\nBcc: everyone@example.com",
+		Subject: "Oi",
+	})
+	if err != ErrInvalidHeader {
+		t.Errorf("Send() = %v, want %v", err, ErrInvalidHeader)
+	}
+}
@@ -1,30 +1,53 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"encoding/base64"
+	"errors"
+	"expvar"
 	"fmt"
 	"html/template"
 	"io"
 	"log/slog"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/billbatista/acasinha-expenses/api"
 	"github.com/billbatista/acasinha-expenses/eventlogger"
 	"github.com/billbatista/acasinha-expenses/ledger"
+	"github.com/billbatista/acasinha-expenses/mailer"
 	"github.com/billbatista/acasinha-expenses/middleware"
+	"github.com/billbatista/acasinha-expenses/password"
+	"github.com/billbatista/acasinha-expenses/projections"
+	"github.com/billbatista/acasinha-expenses/ratelimit"
 	"github.com/billbatista/acasinha-expenses/session"
+	"github.com/billbatista/acasinha-expenses/settings"
+	"github.com/billbatista/acasinha-expenses/token"
+	"github.com/billbatista/acasinha-expenses/totp"
 	"github.com/billbatista/acasinha-expenses/user"
+	"github.com/billbatista/acasinha-expenses/webhook"
 	chimiddleware "github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 )
 
+// loginChallengeCookie holds the login challenge between the password and
+// the 2FA code
+const loginChallengeCookie = "login_challenge"
+
+const defaultDatabaseURL = "host=localhost port=5432 user=postgres password=postgres dbname=expenses sslmode=disable"
+
 func main() {
-	db, err := sql.Open("postgres", "host=localhost port=5432 user=postgres password=postgres dbname=expenses sslmode=disable")
+	db, err := sql.Open("postgres", getenv("DATABASE_URL", defaultDatabaseURL))
 	if err != nil {
 		printErrorAndExit("database connection", err)
 	}
@@ -33,18 +56,82 @@ func main() {
 		printErrorAndExit("pinging database", err)
 	}
 
-	evtlogger := eventlogger.NewSqlEventLogger(db)
-	worker := eventlogger.NewWorker(evtlogger, 100)
+	webhookRepo := webhook.NewRepository(db)
+	sqlEventLogger := eventlogger.NewSqlEventLogger(db)
+	sinks, closeSinks, err := eventSinks(getenv("EVENT_SINKS", "sql"), sqlEventLogger)
+	if err != nil {
+		printErrorAndExit("configuring event sinks", err)
+	}
+	defer closeSinks()
+	evtlogger := webhook.NewLogger(sinks, webhookRepo)
+	worker := eventlogger.NewWorker(evtlogger, 1000,
+		eventlogger.WithBatchSize(50),
+		eventlogger.WithFlushInterval(500*time.Millisecond),
+		eventlogger.WithConsumers(2),
+		eventlogger.WithRetry(5, 200*time.Millisecond),
+		eventlogger.WithSpill(eventlogger.NewSpill("events-spill.jsonl"), 30*time.Second),
+	)
 	worker.Start()
 	defer worker.Shutdown()
-
-	userRepo := user.NewRepository(db)
+	expvar.Publish("eventlogger", expvar.Func(func() any { return worker.Stats() }))
+
+	// domain events are written to the outbox with their transaction and published from there
+	relay := eventlogger.NewRelay(db, evtlogger, time.Second, 100)
+	relay.Start()
+	defer relay.Shutdown()
+
+	// expired events are archived under EVENT_ARCHIVE_DIR before they're deleted
+	pruner := eventlogger.NewPruner(db, []eventlogger.RetentionPolicy{
+		{EventType: "health_request", MaxAge: 7 * 24 * time.Hour},
+		{EventType: "user.*", MaxAge: 365 * 24 * time.Hour},
+		{EventType: "token.*", MaxAge: 365 * 24 * time.Hour},
+	}, getenv("EVENT_ARCHIVE_DIR", "archive/events"), time.Hour)
+	pruner.Start()
+	defer pruner.Shutdown()
+
+	// read models built from events, rebuilt with "go run ./cmd/projections rebuild <name>"
+	projector := eventlogger.NewProjector(db, 5*time.Second, projections.All())
+	projector.Start()
+	defer projector.Shutdown()
+
+	dispatcher := webhook.NewDispatcher(webhookRepo)
+	dispatcher.Start()
+	defer dispatcher.Shutdown()
+
+	mail := mailSender()
+	baseURL := strings.TrimSuffix(getenv("APP_BASE_URL", "http://localhost:5000"), "/")
+
+	passwordPolicy, err := passwordPolicyFromEnv()
+	if err != nil {
+		printErrorAndExit("configuring password policy", err)
+	}
+	userRepo := user.NewRepository(db, user.WithPasswordPolicy(passwordPolicy))
 	sessionRepo := session.NewRepository(db)
 	ledgerRepo := ledger.NewRepository(db)
+	tokenRepo := token.NewRepository(db)
+	settingsRepo := settings.NewRepository(db)
+
+	// expired sessions are rejected on use and deleted here
+	sessionCleaner := session.NewCleaner(sessionRepo, time.Hour)
+	sessionCleaner.Start()
+	defer sessionCleaner.Shutdown()
 
 	router := chi.NewRouter()
+	router.Use(chimiddleware.RequestID)
 	router.Use(chimiddleware.Logger)
-	router.Use(middleware.AuthMiddleware(sessionRepo)) // Add auth middleware globally
+	router.Use(middleware.AuthMiddleware(sessionRepo, tokenRepo, "/api/v1/")) // Add auth middleware globally
+	router.Use(middleware.EventMetadata)
+	router.Use(middleware.CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tmpl, err := parseTemplates(r, "templates/base.html", "templates/csrf.html")
+		if err != nil {
+			slog.Error("failed to parse template", "error", err)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		w.WriteHeader(http.StatusForbidden)
+		tmpl.ExecuteTemplate(w, "base.html", nil)
+	})))
 
 	workDir, _ := os.Getwd()
 	staticDir := http.Dir(filepath.Join(workDir, "./static"))
@@ -57,28 +144,342 @@ func main() {
 			return
 		}
 
-		tmpl, err := template.ParseFiles("templates/base.html", "templates/index.html")
+		tmpl, err := parseTemplates(r, "templates/base.html", "templates/index.html")
 		if err != nil {
 			slog.Error("failed to parse template", "error", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
-		tmpl.ExecuteTemplate(w, "base.html", nil)
+		tmpl.ExecuteTemplate(w, "base.html", map[string]any{
+			"Success":   r.URL.Query().Get("success"),
+			"Error":     r.URL.Query().Get("error"),
+			"MinLength": passwordPolicy.MinLength,
+		})
+	})
+
+	renderPasswordPage := func(w http.ResponseWriter, r *http.Request, page string, data map[string]any) {
+		tmpl, err := parseTemplates(r, "templates/base.html", "templates/"+page)
+		if err != nil {
+			slog.Error("failed to parse template", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		tmpl.ExecuteTemplate(w, "base.html", data)
+	}
+
+	// sendVerification emails the user a link proving they own their address,
+	// in the background like the password reset
+	sendVerification := func(ctx context.Context, u *user.User) error {
+		verificationToken, err := userRepo.CreateEmailVerification(ctx, u.ID, u.Email)
+		if err != nil {
+			return err
+		}
+
+		msg := mailer.Message{
+			To:      u.Email,
+			Subject: "Confirm your email",
+			Body: "Confirm this is your email address by following this link within the next 24 hours:\n" +
+				baseURL + "/verify-email?token=" + url.QueryEscape(verificationToken) + "\n\n" +
+				"Until then you can't join other people's ledgers or add anyone to yours.\n",
+		}
+		go func() {
+			if err := mail.Send(context.WithoutCancel(ctx), msg); err != nil {
+				slog.Error("failed to send verification email", "error", err)
+			}
+		}()
+		return nil
+	}
+
+	router.Get("/verify-email", func(w http.ResponseWriter, r *http.Request) {
+		redirectTo := "/"
+		if middleware.IsAuthenticated(r.Context()) {
+			redirectTo = "/user/profile"
+		}
+
+		verified, err := userRepo.VerifyEmail(r.Context(), r.URL.Query().Get("token"))
+		if err == user.ErrInvalidVerificationToken {
+			http.Redirect(w, r, redirectTo+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			slog.Error("failed to verify email", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		evt := eventlogger.NewEventContext(r.Context(),
+			eventlogger.WithPayload(eventlogger.UserEmailVerified{
+				UserID: verified.ID,
+				Email:  verified.Email,
+			}),
+		)
+		worker.Log(evt)
+
+		http.Redirect(w, r, redirectTo+"?success="+url.QueryEscape("Email confirmed"), http.StatusSeeOther)
+	})
+
+	router.Get("/forgot-password", func(w http.ResponseWriter, r *http.Request) {
+		renderPasswordPage(w, r, "forgot-password.html", nil)
+	})
+
+	// the answer is the same whether the email exists or not, and the email
+	// goes out in the background so timing doesn't tell either
+	router.Post("/forgot-password", func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+
+		found, err := userRepo.GetByEmail(ctx, r.FormValue("email"))
+		if err != nil {
+			slog.Error("failed to fetch user", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if found != nil {
+			resetToken, err := userRepo.CreatePasswordReset(ctx, found.ID)
+			if err != nil {
+				slog.Error("failed to create password reset", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			msg := mailer.Message{
+				To:      found.Email,
+				Subject: "Reset your password",
+				Body: "Someone asked to reset the password of your Expenses account.\n\n" +
+					"Follow this link within the next hour to choose a new one:\n" +
+					baseURL + "/reset-password?token=" + url.QueryEscape(resetToken) + "\n\n" +
+					"If it wasn't you, ignore this email and your password stays the same.\n",
+			}
+			go func() {
+				if err := mail.Send(context.WithoutCancel(ctx), msg); err != nil {
+					slog.Error("failed to send password reset email", "error", err)
+				}
+			}()
+
+			evt := eventlogger.NewEventContext(ctx,
+				eventlogger.WithPayload(eventlogger.UserPasswordResetRequested{
+					UserID: found.ID,
+					Email:  found.Email,
+				}),
+			)
+			worker.Log(evt)
+		}
+
+		renderPasswordPage(w, r, "forgot-password.html", map[string]any{
+			"Success": "Se houver uma conta com esse email, um link para redefinir a senha está a caminho.",
+		})
+	})
+
+	router.Get("/reset-password", func(w http.ResponseWriter, r *http.Request) {
+		renderPasswordPage(w, r, "reset-password.html", map[string]any{
+			"Token":     r.URL.Query().Get("token"),
+			"MinLength": passwordPolicy.MinLength,
+		})
+	})
+
+	router.Post("/reset-password", func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+
+		resetToken := r.FormValue("token")
+		newPassword := r.FormValue("password")
+		if newPassword != r.FormValue("password_confirmation") {
+			renderPasswordPage(w, r, "reset-password.html", map[string]any{
+				"Token":     resetToken,
+				"Error":     "As senhas não conferem",
+				"MinLength": passwordPolicy.MinLength,
+			})
+			return
+		}
+
+		resetUser, err := userRepo.ResetPassword(ctx, resetToken, newPassword)
+		if err != nil {
+			switch {
+			case err == user.ErrBlankPassword, err == user.ErrInvalidResetToken, password.IsRejected(err):
+				renderPasswordPage(w, r, "reset-password.html", map[string]any{
+					"Token":     resetToken,
+					"Error":     err.Error(),
+					"MinLength": passwordPolicy.MinLength,
+				})
+			default:
+				slog.Error("failed to reset password", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// whoever had the old password may still be signed in
+		if err := sessionRepo.DeleteByUserID(ctx, resetUser.ID); err != nil {
+			slog.Error("failed to delete sessions after password reset", "error", err)
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:   session.CookieName,
+			Value:  "",
+			Path:   "/",
+			MaxAge: -1,
+		})
+
+		evt := eventlogger.NewEventContext(ctx,
+			eventlogger.WithPayload(eventlogger.UserPasswordReset{
+				UserID: resetUser.ID,
+			}),
+		)
+		worker.Log(evt)
+
+		http.Redirect(w, r, "/?success="+url.QueryEscape("Senha alterada, entre com a nova"), http.StatusSeeOther)
 	})
 
 	router.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		evt := eventlogger.NewEvent(
-			eventlogger.WithType("health_request"),
-			eventlogger.WithData(map[string]string{
-				"message":     "ok",
-				"http_status": strconv.Itoa(http.StatusOK),
+		evt := eventlogger.NewEventContext(r.Context(),
+			eventlogger.WithPayload(eventlogger.HealthRequested{
+				Message:    "ok",
+				HTTPStatus: http.StatusOK,
 			}),
 		)
 		worker.Log(evt)
 		w.Write([]byte("ok"))
 	})
 
+	loginLimiter := ratelimit.NewLoginLimiter(ratelimit.NewMemoryStore(), ratelimit.DefaultLoginPolicy())
+
+	// loginFailed settles an attempt with a wrong email, password or second
+	// factor, the account gets locked after too many. u is nil when there's
+	// no account with the email.
+	loginFailed := func(r *http.Request, account string, u *user.User, decision ratelimit.LoginDecision) {
+		ctx := r.Context()
+		failures, lockedUntil, err := loginLimiter.Failure(ctx, account, decision)
+		if err != nil {
+			slog.Error("failed to record login failure", "error", err)
+			return
+		}
+
+		var userID *uuid.UUID
+		if u != nil {
+			userID = &u.ID
+		}
+		worker.Log(eventlogger.NewEventContext(ctx,
+			eventlogger.WithPayload(eventlogger.UserLoginFailed{
+				UserID:   userID,
+				Email:    account,
+				Failures: failures,
+			}),
+		))
+
+		if lockedUntil.IsZero() {
+			return
+		}
+		worker.Log(eventlogger.NewEventContext(ctx,
+			eventlogger.WithPayload(eventlogger.UserLockedOut{
+				UserID:   userID,
+				Email:    account,
+				Failures: failures,
+				Until:    lockedUntil,
+			}),
+		))
+
+		if u == nil {
+			return
+		}
+		msg := mailer.Message{
+			To:      u.Email,
+			Subject: "Your account was temporarily locked",
+			Body: fmt.Sprintf("There were %d failed attempts to log in to your Expenses account, so logging in is blocked until %s UTC.\n\n", failures, lockedUntil.UTC().Format("2006-01-02 15:04")) +
+				"If it wasn't you, someone may be guessing your password. You can choose a new one at " + baseURL + "/forgot-password\n",
+		}
+		go func() {
+			if err := mail.Send(context.WithoutCancel(ctx), msg); err != nil {
+				slog.Error("failed to send lockout email", "error", err)
+			}
+		}()
+	}
+
+	// attemptLogin records a login attempt and waits out its delay. It
+	// answers the request itself and returns false when the attempt can't
+	// go ahead.
+	attemptLogin := func(w http.ResponseWriter, r *http.Request, ip, account string) (ratelimit.LoginDecision, bool) {
+		ctx := r.Context()
+		decision, err := loginLimiter.Attempt(ctx, ip, account)
+		if err != nil {
+			slog.Error("failed to check login rate limit", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return decision, false
+		}
+		if !decision.Allowed {
+			minutes := int(math.Ceil(decision.RetryAfter.Minutes()))
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+			http.Error(w, fmt.Sprintf("too many failed logins, try again in %d minutes", minutes), http.StatusTooManyRequests)
+			return decision, false
+		}
+		if decision.Delay > 0 {
+			select {
+			case <-time.After(decision.Delay):
+			case <-ctx.Done():
+				return decision, false
+			}
+		}
+		return decision, true
+	}
+
+	// currentPasswordConfirmed settles the attempt of a profile form that
+	// asks for the current password once it checked out
+	currentPasswordConfirmed := func(ctx context.Context, ip, account string, decision ratelimit.LoginDecision) {
+		if err := loginLimiter.Success(ctx, ip, account, decision); err != nil {
+			slog.Error("failed to reset login failures", "error", err)
+		}
+	}
+
+	// startSession signs the user in on this browser, replacing the session
+	// it had so a token planted in it before can't be signed in with
+	startSession := func(w http.ResponseWriter, r *http.Request, u *user.User) error {
+		if cookie, err := r.Cookie(session.CookieName); err == nil {
+			if err := sessionRepo.Delete(r.Context(), cookie.Value); err != nil {
+				return err
+			}
+		}
+
+		sess, err := sessionRepo.Create(r.Context(), u.ID, r.UserAgent(), middleware.ClientIP(r))
+		if err != nil {
+			return err
+		}
+
+		http.SetCookie(w, session.Cookie(sess.Token, sess.ExpiresAt))
+
+		evt := eventlogger.NewEventContext(r.Context(),
+			eventlogger.WithPayload(eventlogger.UserLoggedIn{
+				UserID:    u.ID,
+				Email:     u.Email,
+				SessionID: sess.ID,
+			}),
+		)
+		worker.Log(evt)
+		return nil
+	}
+
+	// rotateSession gives this browser's session a new token after the
+	// user's privileges change, whoever copied the old one is left out
+	rotateSession := func(w http.ResponseWriter, r *http.Request) {
+		sessionID, ok := middleware.GetSessionID(r.Context())
+		if !ok {
+			return
+		}
+
+		sess, err := sessionRepo.Rotate(r.Context(), sessionID)
+		if err != nil {
+			slog.Error("failed to rotate session", "error", err)
+			return
+		}
+		http.SetCookie(w, session.Cookie(sess.Token, sess.ExpiresAt))
+	}
+
 	router.Post("/user/login", func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		if err := r.ParseForm(); err != nil {
@@ -89,51 +490,169 @@ func main() {
 		email := r.FormValue("email")
 		password := r.FormValue("password")
 
+		account := loginAccount(email)
+		ip := middleware.ClientIP(r)
+
+		decision, ok := attemptLogin(w, r, ip, account)
+		if !ok {
+			return
+		}
+
 		userdb, err := userRepo.GetByEmail(ctx, email)
 		if err != nil {
 			slog.Error("failed to fetch user", "error", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
-		if userdb == nil {
+		if userdb == nil || userRepo.VerifyPassword(userdb.PasswordHash, password) != nil {
+			loginFailed(r, account, userdb, decision)
 			http.Error(w, "invalid email or password", http.StatusUnauthorized)
 			return
 		}
 
-		validPassword := userRepo.VerifyPassword(userdb.PasswordHash, password)
-		if validPassword != nil {
-			http.Error(w, "invalid email or password", http.StatusUnauthorized)
+		// the session only starts once the second factor checks out too, the
+		// attempt keeps counting as a failure until then
+		if userdb.HasTwoFactor() {
+			challenge, err := userRepo.CreateLoginChallenge(ctx, userdb.ID)
+			if err != nil {
+				slog.Error("failed to create login challenge", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			http.SetCookie(w, &http.Cookie{
+				Name:     loginChallengeCookie,
+				Value:    challenge,
+				Path:     "/login/two-factor",
+				MaxAge:   int((5 * time.Minute).Seconds()),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+			http.Redirect(w, r, "/login/two-factor", http.StatusSeeOther)
 			return
 		}
 
-		sess, err := sessionRepo.Create(ctx, userdb.ID)
-		if err != nil {
+		if err := loginLimiter.Success(ctx, ip, account, decision); err != nil {
+			slog.Error("failed to reset login failures", "error", err)
+		}
+		if err := startSession(w, r, userdb); err != nil {
 			slog.Error("failed to create session", "error", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+	})
+
+	renderTwoFactorLogin := func(w http.ResponseWriter, r *http.Request, status int, errMsg string) {
+		tmpl, err := parseTemplates(r, "templates/base.html", "templates/login-two-factor.html")
+		if err != nil {
+			slog.Error("failed to parse template", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(status)
+		tmpl.ExecuteTemplate(w, "base.html", map[string]any{"Error": errMsg})
+	}
+
+	clearLoginChallenge := func(w http.ResponseWriter) {
 		http.SetCookie(w, &http.Cookie{
-			Name:     session.CookieName,
-			Value:    sess.Token,
-			Path:     "/",
-			Expires:  sess.ExpiresAt,
-			HttpOnly: true,
-			Secure:   false,
-			SameSite: http.SameSiteLaxMode,
+			Name:   loginChallengeCookie,
+			Value:  "",
+			Path:   "/login/two-factor",
+			MaxAge: -1,
 		})
+	}
+
+	router.Get("/login/two-factor", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie(loginChallengeCookie); err != nil {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		renderTwoFactorLogin(w, r, http.StatusOK, "")
+	})
+
+	router.Post("/login/two-factor", func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+
+		cookie, err := r.Cookie(loginChallengeCookie)
+		if err != nil {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		// wrong codes count like wrong passwords, or every new challenge
+		// would be a fresh set of guesses
+		challenged, err := userRepo.LoginChallengeUser(ctx, cookie.Value)
+		if err == user.ErrInvalidLoginChallenge {
+			clearLoginChallenge(w)
+			http.Redirect(w, r, "/?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			slog.Error("failed to fetch login challenge", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		account := loginAccount(challenged.Email)
+		ip := middleware.ClientIP(r)
+
+		decision, ok := attemptLogin(w, r, ip, account)
+		if !ok {
+			return
+		}
+
+		loggedIn, usedRecoveryCode, err := userRepo.CompleteLoginChallenge(ctx, cookie.Value, r.FormValue("code"))
+		if err != nil {
+			switch err {
+			case user.ErrInvalidTwoFactorCode:
+				loginFailed(r, account, challenged, decision)
+				renderTwoFactorLogin(w, r, http.StatusUnauthorized, err.Error())
+			case user.ErrInvalidLoginChallenge:
+				clearLoginChallenge(w)
+				http.Redirect(w, r, "/?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			default:
+				slog.Error("failed to complete login challenge", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		clearLoginChallenge(w)
+		if err := loginLimiter.Success(ctx, ip, account, decision); err != nil {
+			slog.Error("failed to reset login failures", "error", err)
+		}
+		if err := startSession(w, r, loggedIn); err != nil {
+			slog.Error("failed to create session", "error", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if !usedRecoveryCode {
+			http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+			return
+		}
 
-		evt := eventlogger.NewEvent(
-			eventlogger.WithType("user.logged_in"),
-			eventlogger.WithData(map[string]string{
-				"user_id":    userdb.ID.String(),
-				"email":      userdb.Email,
-				"session_id": sess.ID.String(),
+		left, err := userRepo.RecoveryCodesLeft(ctx, loggedIn.ID)
+		if err != nil {
+			slog.Error("failed to count recovery codes", "error", err)
+		}
+		evt := eventlogger.NewEventContext(ctx,
+			eventlogger.WithPayload(eventlogger.UserRecoveryCodeUsed{
+				UserID:    loggedIn.ID,
+				CodesLeft: left,
 			}),
 		)
 		worker.Log(evt)
 
-		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+		message := fmt.Sprintf("Você usou um código de recuperação, restam %d. Gere novos códigos se estiverem acabando.", left)
+		http.Redirect(w, r, "/user/two-factor?success="+url.QueryEscape(message), http.StatusSeeOther)
 	})
 	router.Post("/user/register", func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -143,15 +662,13 @@ func main() {
 		}
 
 		email := r.FormValue("email")
-		password := r.FormValue("password")
+		plainPassword := r.FormValue("password")
 
-		registeredUser, err := userRepo.Register(ctx, email, password)
+		registeredUser, err := userRepo.Register(ctx, email, plainPassword)
 		if err != nil {
-			switch err {
-			case user.ErrEmailExists:
-				http.Error(w, err.Error(), http.StatusConflict)
-			case user.ErrBlankPassword, user.ErrInvalidEmail:
-				http.Error(w, err.Error(), http.StatusBadRequest)
+			switch {
+			case err == user.ErrEmailExists, err == user.ErrBlankPassword, err == user.ErrInvalidEmail, password.IsRejected(err):
+				http.Redirect(w, r, "/?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
 			default:
 				slog.Error("failed to register user", "error", err)
 				http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -159,39 +676,46 @@ func main() {
 			return
 		}
 
-		sess, err := sessionRepo.Create(ctx, registeredUser.ID)
+		sess, err := sessionRepo.Create(ctx, registeredUser.ID, r.UserAgent(), middleware.ClientIP(r))
 		if err != nil {
 			slog.Error("failed to create session", "error", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
-		http.SetCookie(w, &http.Cookie{
-			Name:     session.CookieName,
-			Value:    sess.Token,
-			Path:     "/",
-			Expires:  sess.ExpiresAt,
-			HttpOnly: true,
-			Secure:   false,
-			SameSite: http.SameSiteLaxMode,
-		})
+		http.SetCookie(w, session.Cookie(sess.Token, sess.ExpiresAt))
 
-		evt := eventlogger.NewEvent(
-			eventlogger.WithType("user.registered"),
-			eventlogger.WithData(map[string]string{
-				"user_id":    registeredUser.ID.String(),
-				"email":      registeredUser.Email,
-				"session_id": sess.ID.String(),
+		evt := eventlogger.NewEventContext(r.Context(),
+			eventlogger.WithPayload(eventlogger.UserRegistered{
+				UserID:    registeredUser.ID,
+				Email:     registeredUser.Email,
+				SessionID: sess.ID,
 			}),
 		)
 		worker.Log(evt)
 
+		if err := sendVerification(ctx, registeredUser); err != nil {
+			slog.Error("failed to send verification email", "error", err)
+		}
+
 		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
 	})
 
+	router.Route("/admin", adminRoutes(userRepo, sqlEventLogger, settingsRepo, worker))
+
+	// JSON API - answers unauthenticated requests with 401 instead of redirecting
+	apiRoutes := api.NewHandler(ledgerRepo, userRepo).Routes()
+	if err := api.VerifySpec(apiRoutes); err != nil {
+		printErrorAndExit("verifying api spec", err)
+	}
+	router.With(middleware.DenyWithoutTwoFactor(userRepo, settingsRepo, http.HandlerFunc(api.TwoFactorRequired))).
+		Mount("/api/v1", apiRoutes)
+	router.Get("/api/openapi.json", api.SpecHandler)
+
 	// Protected routes - require authentication
 	router.Group(func(r chi.Router) {
 		r.Use(middleware.RequireAuth("/"))
+		r.Use(middleware.RequireTwoFactor(userRepo, settingsRepo, "/user/two-factor", "/user/logout"))
 
 		r.Get("/dashboard", func(w http.ResponseWriter, r *http.Request) {
 			userID, _ := middleware.GetUserID(r.Context())
@@ -211,7 +735,7 @@ func main() {
 					Error:   r.URL.Query().Get("error"),
 				}
 
-				tmpl, err := template.ParseFiles("templates/base.html", "templates/dashboard.html")
+				tmpl, err := parseTemplates(r, "templates/base.html", "templates/dashboard.html")
 				if err != nil {
 					slog.Error("failed to parse template", "error", err)
 					http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -243,6 +767,13 @@ func main() {
 				return
 			}
 
+			settlements, err := ledgerRepo.GetSettlements(r.Context(), ledgerData.ID.String(), 0, 0)
+			if err != nil {
+				slog.Error("failed to get settlements", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
 			memberIDs := make([]uuid.UUID, len(members))
 			memberNames := make(map[uuid.UUID]string)
 			for i, member := range members {
@@ -258,7 +789,7 @@ func main() {
 				}
 			}
 
-			balances := ledger.CalculateBalances(expenses, splits, memberIDs)
+			balances := ledger.CalculateBalances(expenses, splits, settlements, memberIDs)
 
 			balanceViews := make([]BalanceView, 0, len(balances))
 			for userID, amount := range balances {
@@ -283,15 +814,30 @@ func main() {
 				})
 			}
 
+			activity, _, err := ledgerActivity(r.Context(), sqlEventLogger, ledgerRepo, ledgerData.ID, userID, memberNames, "", dashboardActivitySize)
+			if err != nil {
+				slog.Error("failed to get ledger activity", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			unread := 0
+			for _, a := range activity {
+				if a.Unread {
+					unread++
+				}
+			}
+
 			data := DashboardData{
-				Ledger:   ledgerData,
-				Balances: balanceViews,
-				Expenses: expenseViews,
-				Success:  r.URL.Query().Get("success"),
-				Error:    r.URL.Query().Get("error"),
+				Ledger:      ledgerData,
+				Balances:    balanceViews,
+				Expenses:    expenseViews,
+				Activity:    activity,
+				UnreadCount: unread,
+				Success:     r.URL.Query().Get("success"),
+				Error:       r.URL.Query().Get("error"),
 			}
 
-			tmpl, err := template.ParseFiles("templates/base.html", "templates/dashboard.html")
+			tmpl, err := parseTemplates(r, "templates/base.html", "templates/dashboard.html")
 			if err != nil {
 				slog.Error("failed to parse template", "error", err)
 				http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -301,16 +847,20 @@ func main() {
 			tmpl.ExecuteTemplate(w, "base.html", data)
 		})
 
-		r.Get("/ledger/create", func(w http.ResponseWriter, r *http.Request) {
-			tmpl, err := template.ParseFiles("templates/base.html", "templates/create-ledger.html")
+		renderCreateLedger := func(w http.ResponseWriter, r *http.Request, data map[string]any) {
+			tmpl, err := parseTemplates(r, "templates/base.html", "templates/create-ledger.html")
 			if err != nil {
 				slog.Error("failed to parse template", "error", err)
 				http.Error(w, "Internal server error", http.StatusInternalServerError)
 				return
 			}
 
-			tmpl.ExecuteTemplate(w, "base.html", nil)
-		})
+			tmpl.ExecuteTemplate(w, "base.html", data)
+		}
+
+		r.Get("/ledger/create", func(w http.ResponseWriter, r *http.Request) {
+			renderCreateLedger(w, r, nil)
+		})
 
 		r.Post("/ledger/create", func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
@@ -323,35 +873,261 @@ func main() {
 			currency := r.FormValue("currency")
 			userID, _ := middleware.GetUserID(r.Context())
 
+			formError := func(message string) {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				renderCreateLedger(w, r, map[string]any{"Error": message, "Name": name})
+			}
+
 			newLedger, err := ledger.NewLedger(name, currency, userID)
 			if err != nil {
-				slog.Error("failed to create ledger", "error", err)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				switch err {
+				case ledger.ErrEmptyName:
+					formError("Informe um nome para o livro")
+				case ledger.ErrEmptyCurrency:
+					formError("Selecione uma moeda")
+				default:
+					slog.Error("failed to create ledger", "error", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
 				return
 			}
 
 			ledgerId, err := ledgerRepo.CreateNew(ctx, newLedger)
 			if err != nil {
+				if errors.Is(err, ledger.ErrNameTaken) {
+					formError("Já existe um livro com esse nome")
+					return
+				}
 				slog.Error("failed to save ledger", "error", err)
 				http.Error(w, "Internal server error", http.StatusInternalServerError)
 				return
 			}
 
-			evt := eventlogger.NewEvent(
-				eventlogger.WithType("ledger.created"),
-				eventlogger.WithData(map[string]string{
-					"user_id":   userID.String(),
-					"name":      name,
-					"ledger_id": ledgerId,
-					"currency":  currency,
-				}),
-			)
-			worker.Log(evt)
-
 			http.Redirect(w, r, fmt.Sprintf("/ledger/%s", ledgerId), http.StatusSeeOther)
 		})
 
-		r.Get("/user/profile", func(w http.ResponseWriter, r *http.Request) {
+		// renderWebhooks renders the ledger webhooks page, merging extra into the template data
+		renderWebhooks := func(w http.ResponseWriter, r *http.Request, extra map[string]any) {
+			ctx := r.Context()
+
+			ledgerData, err := ledgerRepo.GetLedgerByID(ctx, chi.URLParam(r, "ledgerID"))
+			if err != nil {
+				slog.Error("failed to get ledger", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if ledgerData == nil {
+				http.NotFound(w, r)
+				return
+			}
+
+			subs, err := webhookRepo.GetSubscriptionsByLedger(ctx, ledgerData.ID)
+			if err != nil {
+				slog.Error("failed to get webhooks", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			deliveries, err := webhookRepo.GetDeliveriesByLedger(ctx, ledgerData.ID, 50)
+			if err != nil {
+				slog.Error("failed to get webhook deliveries", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			tmpl, err := parseTemplates(r, "templates/base.html", "templates/webhooks.html")
+			if err != nil {
+				slog.Error("failed to parse template", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			data := map[string]any{
+				"Ledger":        ledgerData,
+				"Subscriptions": subs,
+				"Deliveries":    deliveries,
+				"Success":       r.URL.Query().Get("success"),
+				"Error":         r.URL.Query().Get("error"),
+			}
+			for k, v := range extra {
+				data[k] = v
+			}
+
+			tmpl.ExecuteTemplate(w, "base.html", data)
+		}
+
+		// requireLedgerMember answers 404 unless the user belongs to the ledger in the URL
+		requireLedgerMember := func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userID, _ := middleware.GetUserID(r.Context())
+				ledgerID := chi.URLParam(r, "ledgerID")
+				if _, err := uuid.Parse(ledgerID); err != nil {
+					http.NotFound(w, r)
+					return
+				}
+
+				member, err := ledgerRepo.IsMember(r.Context(), ledgerID, userID.String())
+				if err != nil {
+					slog.Error("failed to check ledger membership", "error", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+				if !member {
+					http.NotFound(w, r)
+					return
+				}
+
+				next.ServeHTTP(w, r)
+			})
+		}
+
+		r.With(requireLedgerMember).Get("/ledger/{ledgerID}/activity", func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := middleware.GetUserID(r.Context())
+			ledgerID := chi.URLParam(r, "ledgerID")
+
+			ledgerData, err := ledgerRepo.GetLedgerByID(r.Context(), ledgerID)
+			if err != nil {
+				slog.Error("failed to get ledger", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if ledgerData == nil {
+				http.NotFound(w, r)
+				return
+			}
+
+			names, err := ledgerMemberNames(r.Context(), ledgerRepo, userRepo, ledgerID)
+			if err != nil {
+				slog.Error("failed to get ledger members", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			activity, next, err := ledgerActivity(r.Context(), sqlEventLogger, ledgerRepo, ledgerData.ID, userID, names, r.URL.Query().Get("cursor"), activityPageSize)
+			if err == eventlogger.ErrInvalidCursor {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				slog.Error("failed to get ledger activity", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			data := LedgerActivityData{Ledger: ledgerData, Activity: activity}
+			if next != "" {
+				data.NextURL = "/ledger/" + ledgerID + "/activity?cursor=" + url.QueryEscape(next)
+			}
+
+			tmpl, err := parseTemplates(r, "templates/base.html", "templates/ledger-activity.html")
+			if err != nil {
+				slog.Error("failed to parse template", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			tmpl.ExecuteTemplate(w, "base.html", data)
+		})
+
+		r.Route("/ledger/{ledgerID}/webhooks", func(r chi.Router) {
+			r.Use(requireLedgerMember)
+
+			r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+				renderWebhooks(w, r, nil)
+			})
+
+			r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+				userID, _ := middleware.GetUserID(r.Context())
+				ledgerID := uuid.MustParse(chi.URLParam(r, "ledgerID"))
+
+				if err := r.ParseForm(); err != nil {
+					http.Error(w, "Invalid form data", http.StatusBadRequest)
+					return
+				}
+
+				sub, err := webhook.NewSubscription(r.Context(), ledgerID, r.FormValue("url"), r.FormValue("secret"), r.FormValue("event_types"), userID)
+				if err != nil {
+					if err == webhook.ErrInvalidURL || err == webhook.ErrForbiddenTarget {
+						renderWebhooks(w, r, map[string]any{"Error": err.Error()})
+						return
+					}
+					slog.Error("failed to create webhook", "error", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+
+				if err := webhookRepo.CreateSubscription(r.Context(), sub); err != nil {
+					slog.Error("failed to save webhook", "error", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+
+				evt := eventlogger.NewEventContext(r.Context(),
+					eventlogger.WithPayload(eventlogger.WebhookCreated{
+						UserID:    userID,
+						LedgerID:  ledgerID,
+						WebhookID: sub.ID,
+						URL:       sub.URL,
+					}),
+				)
+				worker.Log(evt)
+
+				// The secret is shown this once, like tokens
+				renderWebhooks(w, r, map[string]any{
+					"Success":   "Webhook criado",
+					"NewSecret": sub.Secret,
+				})
+			})
+
+			r.Post("/{webhookID}/delete", func(w http.ResponseWriter, r *http.Request) {
+				ledgerID := uuid.MustParse(chi.URLParam(r, "ledgerID"))
+
+				webhookID, err := uuid.Parse(chi.URLParam(r, "webhookID"))
+				if err != nil {
+					http.NotFound(w, r)
+					return
+				}
+
+				err = webhookRepo.DeleteSubscription(r.Context(), ledgerID, webhookID)
+				if err != nil {
+					if err == webhook.ErrNotFound {
+						http.NotFound(w, r)
+						return
+					}
+					slog.Error("failed to delete webhook", "error", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+
+				http.Redirect(w, r, fmt.Sprintf("/ledger/%s/webhooks?success=%s", ledgerID, url.QueryEscape("Webhook excluído")), http.StatusSeeOther)
+			})
+
+			r.Post("/deliveries/{deliveryID}/retry", func(w http.ResponseWriter, r *http.Request) {
+				ledgerID := uuid.MustParse(chi.URLParam(r, "ledgerID"))
+
+				deliveryID, err := uuid.Parse(chi.URLParam(r, "deliveryID"))
+				if err != nil {
+					http.NotFound(w, r)
+					return
+				}
+
+				err = webhookRepo.Retry(r.Context(), ledgerID, deliveryID)
+				if err != nil {
+					if err == webhook.ErrNotFound {
+						http.NotFound(w, r)
+						return
+					}
+					slog.Error("failed to retry webhook delivery", "error", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+
+				http.Redirect(w, r, fmt.Sprintf("/ledger/%s/webhooks?success=%s", ledgerID, url.QueryEscape("Entrega colocada na fila novamente")), http.StatusSeeOther)
+			})
+		})
+
+		// renderProfile renders the profile page, merging extra into the template data
+		renderProfile := func(w http.ResponseWriter, r *http.Request, extra map[string]any) {
 			userID, _ := middleware.GetUserID(r.Context())
 
 			user, err := userRepo.GetByID(r.Context(), userID)
@@ -361,7 +1137,22 @@ func main() {
 				return
 			}
 
-			tmpl, err := template.ParseFiles("templates/base.html", "templates/profile.html")
+			tokens, err := tokenRepo.ListByUserID(r.Context(), userID)
+			if err != nil {
+				slog.Error("failed to fetch tokens", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			sessions, err := sessionRepo.ListByUserID(r.Context(), userID)
+			if err != nil {
+				slog.Error("failed to fetch sessions", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			currentSessionID, _ := middleware.GetSessionID(r.Context())
+
+			tmpl, err := parseTemplates(r, "templates/base.html", "templates/profile.html")
 			if err != nil {
 				slog.Error("failed to parse template", "error", err)
 				http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -369,10 +1160,525 @@ func main() {
 			}
 
 			data := map[string]any{
-				"User": user,
+				"User":             user,
+				"Tokens":           tokens,
+				"Sessions":         sessions,
+				"CurrentSessionID": currentSessionID,
+				"MinLength":        passwordPolicy.MinLength,
+				"Success":          r.URL.Query().Get("success"),
+				"Error":            r.URL.Query().Get("error"),
+			}
+			for k, v := range extra {
+				data[k] = v
+			}
+
+			tmpl.ExecuteTemplate(w, "base.html", data)
+		}
+
+		r.Get("/user/profile", func(w http.ResponseWriter, r *http.Request) {
+			renderProfile(w, r, nil)
+		})
+
+		r.Post("/user/profile/verification", func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := middleware.GetUserID(r.Context())
+
+			u, err := userRepo.GetByID(r.Context(), userID)
+			if err != nil {
+				slog.Error("failed to fetch user", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if u.IsVerified() {
+				http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+				return
+			}
+
+			if err := sendVerification(r.Context(), u); err != nil {
+				slog.Error("failed to send verification email", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			http.Redirect(w, r, "/user/profile?success="+url.QueryEscape("Enviamos um novo link de confirmação para "+u.Email), http.StatusSeeOther)
+		})
+
+		r.Post("/user/profile/password", func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			userID, _ := middleware.GetUserID(ctx)
+
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+
+			newPassword := r.FormValue("new_password")
+			if newPassword != r.FormValue("new_password_confirmation") {
+				renderProfile(w, r, map[string]any{"Error": "As senhas não conferem"})
+				return
+			}
+
+			current, err := userRepo.GetByID(ctx, userID)
+			if err != nil {
+				slog.Error("failed to fetch user", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			// a stolen session could guess the password here otherwise
+			account := loginAccount(current.Email)
+			ip := middleware.ClientIP(r)
+			decision, ok := attemptLogin(w, r, ip, account)
+			if !ok {
+				return
+			}
+
+			err = userRepo.ChangePassword(ctx, userID, r.FormValue("current_password"), newPassword)
+			if err != nil {
+				switch {
+				case err == user.ErrWrongPassword:
+					loginFailed(r, account, current, decision)
+					renderProfile(w, r, map[string]any{"Error": err.Error()})
+				case err == user.ErrSamePassword, err == user.ErrBlankPassword, password.IsRejected(err):
+					currentPasswordConfirmed(ctx, ip, account, decision)
+					renderProfile(w, r, map[string]any{"Error": err.Error()})
+				default:
+					slog.Error("failed to change password", "error", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			currentPasswordConfirmed(ctx, ip, account, decision)
+
+			// whoever had the old password may still be signed in elsewhere
+			if sessionID, ok := middleware.GetSessionID(ctx); ok {
+				if err := sessionRepo.DeleteOthers(ctx, userID, sessionID); err != nil {
+					slog.Error("failed to delete other sessions after password change", "error", err)
+				}
+			}
+			rotateSession(w, r)
+
+			if u, err := userRepo.GetByID(ctx, userID); err == nil && u != nil {
+				msg := mailer.Message{
+					To:      u.Email,
+					Subject: "Your password was changed",
+					Body: "The password of your Expenses account was just changed, every other session was signed out and its access tokens were revoked.\n\n" +
+						"If it wasn't you, reset it right away at " + baseURL + "/forgot-password\n",
+				}
+				go func() {
+					if err := mail.Send(context.WithoutCancel(ctx), msg); err != nil {
+						slog.Error("failed to send password changed email", "error", err)
+					}
+				}()
+			}
+
+			evt := eventlogger.NewEventContext(ctx,
+				eventlogger.WithPayload(eventlogger.UserPasswordChanged{
+					UserID: userID,
+				}),
+			)
+			worker.Log(evt)
+
+			http.Redirect(w, r, "/user/profile?success="+url.QueryEscape("Senha alterada, as outras sessões foram encerradas e os tokens de acesso revogados"), http.StatusSeeOther)
+		})
+
+		r.Post("/user/profile/email", func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			userID, _ := middleware.GetUserID(ctx)
+
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+
+			previous, err := userRepo.GetByID(ctx, userID)
+			if err != nil {
+				slog.Error("failed to fetch user", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			account := loginAccount(previous.Email)
+			ip := middleware.ClientIP(r)
+			decision, ok := attemptLogin(w, r, ip, account)
+			if !ok {
+				return
+			}
+
+			changed, err := userRepo.ChangeEmail(ctx, userID, r.FormValue("current_password"), r.FormValue("email"))
+			if err != nil {
+				switch err {
+				case user.ErrWrongPassword:
+					loginFailed(r, account, previous, decision)
+					renderProfile(w, r, map[string]any{"Error": err.Error()})
+				case user.ErrSameEmail, user.ErrInvalidEmail, user.ErrEmailExists:
+					currentPasswordConfirmed(ctx, ip, account, decision)
+					renderProfile(w, r, map[string]any{"Error": err.Error()})
+				default:
+					slog.Error("failed to change email", "error", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			currentPasswordConfirmed(ctx, ip, account, decision)
+			if err := sendVerification(ctx, changed); err != nil {
+				slog.Error("failed to send verification email", "error", err)
+			}
+
+			rotateSession(w, r)
+
+			// the old address hears about it in case the account was taken over
+			msg := mailer.Message{
+				To:      previous.Email,
+				Subject: "Your email was changed",
+				Body: "The email of your Expenses account was changed from this address to " + changed.Email + ".\n\n" +
+					"If it wasn't you, reply to this email so we can help you get your account back.\n",
+			}
+			go func() {
+				if err := mail.Send(context.WithoutCancel(ctx), msg); err != nil {
+					slog.Error("failed to send email changed notice", "error", err)
+				}
+			}()
+
+			evt := eventlogger.NewEventContext(ctx,
+				eventlogger.WithPayload(eventlogger.UserEmailChanged{
+					UserID:   userID,
+					OldEmail: previous.Email,
+					NewEmail: changed.Email,
+				}),
+			)
+			worker.Log(evt)
+
+			http.Redirect(w, r, "/user/profile?success="+url.QueryEscape("Email alterado, enviamos um link de confirmação para "+changed.Email), http.StatusSeeOther)
+		})
+
+		renderTwoFactor := func(w http.ResponseWriter, r *http.Request, extra map[string]any) {
+			ctx := r.Context()
+			userID, _ := middleware.GetUserID(ctx)
+
+			u, err := userRepo.GetByID(ctx, userID)
+			if err != nil {
+				slog.Error("failed to fetch user", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			required, err := settingsRepo.Bool(ctx, settings.TwoFactorRequired)
+			if err != nil {
+				slog.Error("failed to read two-factor setting", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			data := map[string]any{
+				"Enabled":  u.HasTwoFactor(),
+				"Required": required,
+				"Success":  r.URL.Query().Get("success"),
+				"Error":    r.URL.Query().Get("error"),
+			}
+
+			if u.HasTwoFactor() {
+				left, err := userRepo.RecoveryCodesLeft(ctx, userID)
+				if err != nil {
+					slog.Error("failed to count recovery codes", "error", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+				data["CodesLeft"] = left
+			} else {
+				secret, err := userRepo.BeginTwoFactor(ctx, userID)
+				if err != nil {
+					slog.Error("failed to begin two-factor setup", "error", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+				png, err := totp.QRCode(totp.URI("Expenses", u.Email, secret))
+				if err != nil {
+					slog.Error("failed to render qr code", "error", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+				data["Secret"] = secret
+				data["QRCode"] = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+			}
+
+			for k, v := range extra {
+				data[k] = v
+			}
+
+			tmpl, err := parseTemplates(r, "templates/base.html", "templates/two-factor.html")
+			if err != nil {
+				slog.Error("failed to parse template", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
 			}
 
 			tmpl.ExecuteTemplate(w, "base.html", data)
+		}
+
+		r.Get("/user/two-factor", func(w http.ResponseWriter, r *http.Request) {
+			renderTwoFactor(w, r, nil)
+		})
+
+		r.Post("/user/two-factor/enable", func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			userID, _ := middleware.GetUserID(ctx)
+
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+
+			codes, err := userRepo.EnableTwoFactor(ctx, userID, r.FormValue("code"))
+			if err != nil {
+				switch err {
+				case user.ErrInvalidTwoFactorCode, user.ErrTwoFactorEnabled:
+					renderTwoFactor(w, r, map[string]any{"Error": err.Error()})
+				default:
+					slog.Error("failed to enable two-factor", "error", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			rotateSession(w, r)
+
+			evt := eventlogger.NewEventContext(ctx,
+				eventlogger.WithPayload(eventlogger.UserTwoFactorEnabled{
+					UserID: userID,
+				}),
+			)
+			worker.Log(evt)
+
+			// The recovery codes are shown once, only their hashes are kept
+			renderTwoFactor(w, r, map[string]any{
+				"RecoveryCodes": codes,
+				"Success":       "Autenticação em dois fatores ativada",
+			})
+		})
+
+		r.Post("/user/two-factor/recovery-codes", func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			userID, _ := middleware.GetUserID(ctx)
+
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+
+			if _, err := userRepo.VerifyTwoFactor(ctx, userID, r.FormValue("code")); err != nil {
+				switch err {
+				case user.ErrInvalidTwoFactorCode, user.ErrTwoFactorNotEnabled:
+					renderTwoFactor(w, r, map[string]any{"Error": err.Error()})
+				default:
+					slog.Error("failed to verify two-factor code", "error", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			codes, err := userRepo.RegenerateRecoveryCodes(ctx, userID)
+			if err != nil {
+				slog.Error("failed to regenerate recovery codes", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			renderTwoFactor(w, r, map[string]any{
+				"RecoveryCodes": codes,
+				"Success":       "Novos códigos de recuperação gerados, os antigos não funcionam mais",
+			})
+		})
+
+		r.Post("/user/two-factor/disable", func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			userID, _ := middleware.GetUserID(ctx)
+
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+
+			required, err := settingsRepo.Bool(ctx, settings.TwoFactorRequired)
+			if err != nil {
+				slog.Error("failed to read two-factor setting", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if required {
+				renderTwoFactor(w, r, map[string]any{"Error": "A autenticação em dois fatores é obrigatória e não pode ser desativada"})
+				return
+			}
+
+			err = userRepo.DisableTwoFactor(ctx, userID, r.FormValue("current_password"))
+			if err != nil {
+				switch err {
+				case user.ErrWrongPassword, user.ErrTwoFactorNotEnabled:
+					renderTwoFactor(w, r, map[string]any{"Error": err.Error()})
+				default:
+					slog.Error("failed to disable two-factor", "error", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			rotateSession(w, r)
+
+			evt := eventlogger.NewEventContext(ctx,
+				eventlogger.WithPayload(eventlogger.UserTwoFactorDisabled{
+					UserID: userID,
+				}),
+			)
+			worker.Log(evt)
+
+			http.Redirect(w, r, "/user/profile?success="+url.QueryEscape("Autenticação em dois fatores desativada"), http.StatusSeeOther)
+		})
+
+		r.Post("/user/profile/tokens", func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := middleware.GetUserID(r.Context())
+
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, "Invalid form data", http.StatusBadRequest)
+				return
+			}
+
+			var scopes []token.Scope
+			for _, s := range r.Form["scopes"] {
+				scope, err := token.ParseScope(s)
+				if err != nil {
+					renderProfile(w, r, map[string]any{"Error": err.Error()})
+					return
+				}
+				scopes = append(scopes, scope)
+			}
+
+			var expiresAt *time.Time
+			if days, err := strconv.Atoi(r.FormValue("expires_in_days")); err == nil && days > 0 {
+				t := time.Now().UTC().AddDate(0, 0, days)
+				expiresAt = &t
+			}
+
+			tok, plaintext, err := tokenRepo.Create(r.Context(), userID, r.FormValue("name"), scopes, expiresAt)
+			if err != nil {
+				switch err {
+				case token.ErrEmptyName, token.ErrNameTooLong, token.ErrInvalidScope:
+					renderProfile(w, r, map[string]any{"Error": err.Error()})
+				default:
+					slog.Error("failed to create token", "error", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			evt := eventlogger.NewEventContext(r.Context(),
+				eventlogger.WithPayload(eventlogger.TokenCreated{
+					UserID:  userID,
+					TokenID: tok.ID,
+					Name:    tok.Name,
+				}),
+			)
+			worker.Log(evt)
+
+			// The plaintext is shown once, it can't be recovered afterwards
+			renderProfile(w, r, map[string]any{
+				"NewToken": plaintext,
+				"Success":  "Token criado, copie-o agora",
+			})
+		})
+
+		r.Post("/user/profile/tokens/{tokenID}/revoke", func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := middleware.GetUserID(r.Context())
+
+			tokenID, err := uuid.Parse(chi.URLParam(r, "tokenID"))
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusBadRequest)
+				return
+			}
+
+			err = tokenRepo.Revoke(r.Context(), userID, tokenID)
+			if err != nil {
+				if err == token.ErrNotFound {
+					http.Error(w, err.Error(), http.StatusNotFound)
+					return
+				}
+				slog.Error("failed to revoke token", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			evt := eventlogger.NewEventContext(r.Context(),
+				eventlogger.WithPayload(eventlogger.TokenRevoked{
+					UserID:  userID,
+					TokenID: tokenID,
+				}),
+			)
+			worker.Log(evt)
+
+			http.Redirect(w, r, "/user/profile?success="+url.QueryEscape("Token revogado"), http.StatusSeeOther)
+		})
+
+		r.Post("/user/profile/sessions/{sessionID}/revoke", func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			userID, _ := middleware.GetUserID(ctx)
+
+			sessionID, err := uuid.Parse(chi.URLParam(r, "sessionID"))
+			if err != nil {
+				http.Error(w, "Invalid session", http.StatusBadRequest)
+				return
+			}
+			if current, _ := middleware.GetSessionID(ctx); current == sessionID {
+				renderProfile(w, r, map[string]any{"Error": "Para encerrar a sessão deste dispositivo, use Sair"})
+				return
+			}
+
+			err = sessionRepo.DeleteByID(ctx, userID, sessionID)
+			if err != nil {
+				if err == session.ErrNotFound {
+					http.Error(w, err.Error(), http.StatusNotFound)
+					return
+				}
+				slog.Error("failed to revoke session", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			evt := eventlogger.NewEventContext(ctx,
+				eventlogger.WithPayload(eventlogger.UserSessionRevoked{
+					UserID:    userID,
+					SessionID: sessionID,
+				}),
+			)
+			worker.Log(evt)
+
+			http.Redirect(w, r, "/user/profile?success="+url.QueryEscape("Sessão encerrada"), http.StatusSeeOther)
+		})
+
+		r.Post("/user/profile/sessions/revoke-others", func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			userID, _ := middleware.GetUserID(ctx)
+
+			current, ok := middleware.GetSessionID(ctx)
+			if !ok {
+				http.Error(w, "Invalid session", http.StatusBadRequest)
+				return
+			}
+
+			if err := sessionRepo.DeleteOthers(ctx, userID, current); err != nil {
+				slog.Error("failed to revoke other sessions", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			evt := eventlogger.NewEventContext(ctx,
+				eventlogger.WithPayload(eventlogger.UserSignedOutElsewhere{
+					UserID:    userID,
+					SessionID: current,
+				}),
+			)
+			worker.Log(evt)
+
+			http.Redirect(w, r, "/user/profile?success="+url.QueryEscape("Todas as outras sessões foram encerradas"), http.StatusSeeOther)
 		})
 
 		r.Get("/user/profile/avatar", func(w http.ResponseWriter, r *http.Request) {
@@ -406,11 +1712,10 @@ func main() {
 				return
 			}
 
-			evt := eventlogger.NewEvent(
-				eventlogger.WithType("user.name_updated"),
-				eventlogger.WithData(map[string]string{
-					"user_id": userID.String(),
-					"name":    name,
+			evt := eventlogger.NewEventContext(r.Context(),
+				eventlogger.WithPayload(eventlogger.UserNameUpdated{
+					UserID: userID,
+					Name:   name,
 				}),
 			)
 			worker.Log(evt)
@@ -448,11 +1753,10 @@ func main() {
 				return
 			}
 
-			evt := eventlogger.NewEvent(
-				eventlogger.WithType("user.avatar_updated"),
-				eventlogger.WithData(map[string]string{
-					"user_id": userID.String(),
-					"file":    handler.Filename,
+			evt := eventlogger.NewEventContext(r.Context(),
+				eventlogger.WithPayload(eventlogger.UserAvatarUpdated{
+					UserID: userID,
+					File:   handler.Filename,
 				}),
 			)
 			worker.Log(evt)
@@ -483,11 +1787,13 @@ func main() {
 
 // View types for templates
 type DashboardData struct {
-	Ledger   *ledger.Ledger
-	Balances []BalanceView
-	Expenses []ExpenseView
-	Success  string
-	Error    string
+	Ledger      *ledger.Ledger
+	Balances    []BalanceView
+	Expenses    []ExpenseView
+	Activity    []ActivityView
+	UnreadCount int
+	Success     string
+	Error       string
 }
 
 type BalanceView struct {
@@ -512,6 +1818,135 @@ func formatCurrency(amountCents int64) string {
 	return fmt.Sprintf("%s %.2f", "R$", amount)
 }
 
+// loginAccount is the key login failures are counted under for an email,
+// so "Foo@x.com" and "foo@x.com" share them
+func loginAccount(email string) string {
+	account, err := user.NormalizeEmail(email)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(email))
+	}
+	return account
+}
+
+// mailSender sends through MAIL_SMTP_ADDR when set, and only logs emails
+// otherwise
+func mailSender() mailer.Sender {
+	addr := getenv("MAIL_SMTP_ADDR", "")
+	if addr == "" {
+		return mailer.NewLogSender()
+	}
+	return mailer.NewSMTPSender(
+		addr,
+		getenv("MAIL_FROM", "Expenses <no-reply@acasinha.local>"),
+		getenv("MAIL_SMTP_USERNAME", ""),
+		getenv("MAIL_SMTP_PASSWORD", ""),
+	)
+}
+
+// passwordPolicyFromEnv reads the password policy from PASSWORD_MIN_LENGTH,
+// PASSWORD_MIN_SCORE (0 to 4) and PASSWORD_BREACHED_FILE, a list of SHA-1
+// hashes of breached passwords checked offline. Without the file there's
+// no breach check.
+func passwordPolicyFromEnv() (password.Policy, error) {
+	policy := password.DefaultPolicy()
+
+	minLength, err := strconv.Atoi(getenv("PASSWORD_MIN_LENGTH", strconv.Itoa(policy.MinLength)))
+	if err != nil || minLength < 1 {
+		return policy, fmt.Errorf("invalid PASSWORD_MIN_LENGTH %q", os.Getenv("PASSWORD_MIN_LENGTH"))
+	}
+	minScore, err := strconv.Atoi(getenv("PASSWORD_MIN_SCORE", strconv.Itoa(policy.MinScore)))
+	if err != nil || minScore < 0 || minScore > 4 {
+		return policy, fmt.Errorf("invalid PASSWORD_MIN_SCORE %q", os.Getenv("PASSWORD_MIN_SCORE"))
+	}
+	policy.MinLength, policy.MinScore = minLength, minScore
+
+	if path := getenv("PASSWORD_BREACHED_FILE", ""); path != "" {
+		breached, err := password.LoadBreached(path)
+		if err != nil {
+			return policy, fmt.Errorf("loading breached passwords: %w", err)
+		}
+		slog.Info("loaded breached passwords", "count", breached.Len())
+		policy.Breached = breached
+	}
+
+	return policy, nil
+}
+
+// parseTemplates parses page templates with the helpers they use bound to
+// the request, like csrfField, which every form must include
+func parseTemplates(r *http.Request, files ...string) (*template.Template, error) {
+	return template.New(filepath.Base(files[0])).Funcs(template.FuncMap{
+		"csrfField": func() template.HTML { return middleware.CSRFField(r.Context()) },
+	}).ParseFiles(files...)
+}
+
+func getenv(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
+// eventSinks builds the logger events are fanned out to from a comma
+// separated list of sinks: sql, stdout and file. The file sink writes to
+// EVENT_LOG_FILE, rotating at EVENT_LOG_MAX_BYTES and keeping
+// EVENT_LOG_MAX_FILES old files.
+func eventSinks(names string, sqlLogger eventlogger.EventLogger) (eventlogger.EventLogger, func(), error) {
+	var sinks []eventlogger.Sink
+	closers := []func() error{}
+
+	for name := range strings.SplitSeq(names, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && slices.ContainsFunc(sinks, func(s eventlogger.Sink) bool { return s.Name == name }) {
+			return nil, nil, fmt.Errorf("event sink %q configured twice", name)
+		}
+
+		switch name {
+		case "sql":
+			sinks = append(sinks, eventlogger.Sink{Name: name, Logger: sqlLogger})
+		case "stdout":
+			sinks = append(sinks, eventlogger.Sink{Name: name, Logger: eventlogger.NewSlogEventLogger(os.Stdout)})
+		case "file":
+			maxBytes, err := strconv.ParseInt(getenv("EVENT_LOG_MAX_BYTES", "10485760"), 10, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid EVENT_LOG_MAX_BYTES: %w", err)
+			}
+			maxFiles, err := strconv.Atoi(getenv("EVENT_LOG_MAX_FILES", "5"))
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid EVENT_LOG_MAX_FILES: %w", err)
+			}
+			fileLogger := eventlogger.NewFileEventLogger(getenv("EVENT_LOG_FILE", "events.jsonl"), maxBytes, maxFiles)
+			sinks = append(sinks, eventlogger.Sink{Name: name, Logger: fileLogger})
+			closers = append(closers, fileLogger.Close)
+		case "":
+		default:
+			return nil, nil, fmt.Errorf("unknown event sink %q", name)
+		}
+	}
+	if len(sinks) == 0 {
+		return nil, nil, fmt.Errorf("no event sinks configured")
+	}
+
+	closeAll := func() {
+		for _, c := range closers {
+			if err := c(); err != nil {
+				slog.Error("failed to close event sink", "error", err)
+			}
+		}
+	}
+	if len(sinks) == 1 {
+		return sinks[0].Logger, closeAll, nil
+	}
+
+	// the database is the record the rest of the app reads, the other sinks
+	// are copies whose failures shouldn't have it written twice
+	primary := max(slices.IndexFunc(sinks, func(s eventlogger.Sink) bool { return s.Name == "sql" }), 0)
+	secondary := append(slices.Clone(sinks[:primary]), sinks[primary+1:]...)
+	multi := eventlogger.NewMultiLogger(sinks[primary], secondary...)
+	expvar.Publish("eventsinks", expvar.Func(func() any { return multi.Stats() }))
+	return multi, closeAll, nil
+}
+
 func printErrorAndExit(msg string, e error) {
 	slog.Error(msg, "error", e)
 	os.Exit(1)
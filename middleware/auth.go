@@ -4,19 +4,48 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/billbatista/acasinha-expenses/session"
+	"github.com/billbatista/acasinha-expenses/token"
+	"github.com/billbatista/acasinha-expenses/user"
 	"github.com/google/uuid"
 )
 
 type contextKey string
 
-const UserIDKey contextKey = "user_id"
+const (
+	UserIDKey    contextKey = "user_id"
+	TokenKey     contextKey = "token"
+	SessionIDKey contextKey = "session_id"
+)
 
-// AuthMiddleware checks if user has a valid session
-func AuthMiddleware(sessionRepo session.Repository) func(http.Handler) http.Handler {
+// AuthMiddleware checks if user has a valid session, or a personal access
+// token in the Authorization header. Tokens are only accepted on paths under
+// tokenPrefix, the JSON API, which checks their scopes; anywhere else they'd
+// be a full login, able to mint themselves more scopes or change the password.
+func AuthMiddleware(sessionRepo session.Repository, tokenRepo token.Repository, tokenPrefix string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if bearer, ok := bearerToken(r); ok && strings.HasPrefix(r.URL.Path, tokenPrefix) {
+				tok, err := tokenRepo.GetByPlaintext(r.Context(), bearer)
+				if err != nil {
+					slog.Info("invalid bearer token", "error", err)
+					next.ServeHTTP(w, r)
+					return
+				}
+
+				if err := tokenRepo.TouchLastUsed(r.Context(), tok.ID); err != nil {
+					slog.Error("failed to update token last used", "error", err)
+				}
+
+				ctx := context.WithValue(r.Context(), UserIDKey, tok.UserID)
+				ctx = context.WithValue(ctx, TokenKey, tok)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			cookie, err := r.Cookie(session.CookieName)
 			if err != nil {
 				slog.Info("no cookie found, not authenticated")
@@ -37,8 +66,19 @@ func AuthMiddleware(sessionRepo session.Repository) func(http.Handler) http.Hand
 				return
 			}
 
+			// using the session slides its expiration, the cookie's too
+			if time.Since(sess.LastSeenAt) > session.TouchInterval {
+				expires, err := sessionRepo.Touch(r.Context(), sess.ID, ClientIP(r))
+				if err != nil {
+					slog.Error("failed to update session last seen", "error", err)
+				} else {
+					http.SetCookie(w, session.Cookie(cookie.Value, expires))
+				}
+			}
+
 			// Valid session - add user ID to context
 			ctx := context.WithValue(r.Context(), UserIDKey, sess.UserID)
+			ctx = context.WithValue(ctx, SessionIDKey, sess.ID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -58,14 +98,75 @@ func RequireAuth(redirectTo string) func(http.Handler) http.Handler {
 	}
 }
 
+// RequireAdmin answers 404 to anyone but admins, so admin pages aren't discoverable
+func RequireAdmin(userRepo user.Repository) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := GetUserID(r.Context())
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+
+			u, err := userRepo.GetByID(r.Context(), userID)
+			if err != nil {
+				slog.Error("failed to fetch user", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if u == nil || !u.IsAdmin {
+				http.NotFound(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // GetUserID extracts user ID from context
 func GetUserID(ctx context.Context) (uuid.UUID, bool) {
 	userID, ok := ctx.Value(UserIDKey).(uuid.UUID)
 	return userID, ok
 }
 
+// GetSessionID extracts the session ID from context, only set for browser sessions
+func GetSessionID(ctx context.Context) (uuid.UUID, bool) {
+	sessionID, ok := ctx.Value(SessionIDKey).(uuid.UUID)
+	return sessionID, ok
+}
+
 // IsAuthenticated checks if user is authenticated
 func IsAuthenticated(ctx context.Context) bool {
 	_, ok := GetUserID(ctx)
 	return ok
 }
+
+// HasScope checks whether the request may act with the given scope. Browser
+// sessions have every scope; token requests only the ones granted.
+func HasScope(ctx context.Context, scope token.Scope) bool {
+	if !IsAuthenticated(ctx) {
+		return false
+	}
+	tok, ok := requestToken(ctx)
+	if !ok {
+		return true
+	}
+	return tok.HasScope(scope)
+}
+
+// requestToken returns the token the request was authenticated with, if it
+// was with one rather than a session
+func requestToken(ctx context.Context) (*token.Token, bool) {
+	tok, ok := ctx.Value(TokenKey).(*token.Token)
+	return tok, ok
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	scheme, value, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || value == "" {
+		return "", false
+	}
+	return strings.TrimSpace(value), true
+}
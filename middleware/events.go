@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/billbatista/acasinha-expenses/eventlogger"
+	chimiddleware "github.com/go-chi/chi/middleware"
+)
+
+// EventMetadata stores the request details in the context so events created
+// with eventlogger.NewEventContext carry them. It must run after
+// chimiddleware.RequestID and AuthMiddleware.
+func EventMetadata(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		metadata := map[string]string{
+			eventlogger.MetadataClientIP: ClientIP(r),
+		}
+
+		if requestID := chimiddleware.GetReqID(ctx); requestID != "" {
+			metadata[eventlogger.MetadataRequestID] = requestID
+		}
+		if userAgent := r.UserAgent(); userAgent != "" {
+			metadata[eventlogger.MetadataUserAgent] = userAgent
+		}
+		if userID, ok := GetUserID(ctx); ok {
+			metadata[eventlogger.MetadataUserID] = userID.String()
+		}
+		if sessionID, ok := GetSessionID(ctx); ok {
+			metadata[eventlogger.MetadataSessionID] = sessionID.String()
+		}
+
+		next.ServeHTTP(w, r.WithContext(eventlogger.ContextWithMetadata(ctx, metadata)))
+	})
+}
+
+// ClientIP is the address the request came from, without the port
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/billbatista/acasinha-expenses/settings"
+	"github.com/billbatista/acasinha-expenses/user"
+)
+
+// RequireTwoFactor sends signed in users without 2FA to setupPath while an
+// admin requires it. Paths starting with setupPath or one of allowed still
+// go through, so they can set it up or log out.
+func RequireTwoFactor(userRepo user.Repository, settingsRepo settings.Repository, setupPath string, allowed ...string) func(http.Handler) http.Handler {
+	setup := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, setupPath, http.StatusSeeOther)
+	})
+	return requireTwoFactor(userRepo, settingsRepo, setup, append(allowed, setupPath))
+}
+
+// DenyWithoutTwoFactor is RequireTwoFactor for the JSON API: requests from
+// users without 2FA while an admin requires it are handed to denied. It
+// covers tokens too, one created before the policy mustn't outlive it.
+func DenyWithoutTwoFactor(userRepo user.Repository, settingsRepo settings.Repository, denied http.Handler) func(http.Handler) http.Handler {
+	return requireTwoFactor(userRepo, settingsRepo, denied, nil)
+}
+
+func requireTwoFactor(userRepo user.Repository, settingsRepo settings.Repository, denied http.Handler, allowed []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := GetUserID(r.Context())
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			for _, prefix := range allowed {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			required, err := settingsRepo.Bool(r.Context(), settings.TwoFactorRequired)
+			if err != nil {
+				slog.Error("failed to read two-factor setting", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if !required {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			u, err := userRepo.GetByID(r.Context(), userID)
+			if err != nil {
+				slog.Error("failed to fetch user", "error", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if u != nil && u.HasTwoFactor() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			denied.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS ledger_settlements (
+    id UUID PRIMARY KEY,
+    ledger_id UUID NOT NULL REFERENCES ledgers(id) ON DELETE CASCADE,
+    from_user UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    to_user UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_ledger_settlements_ledger_id ON ledger_settlements(ledger_id);
+CREATE INDEX idx_ledger_settlements_created_at ON ledger_settlements(created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS ledger_settlements;
+-- +goose StatementEnd
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS projection_checkpoints (
+    name VARCHAR(100) PRIMARY KEY,
+    last_created_at TIMESTAMP WITH TIME ZONE,
+    last_event_id UUID,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- read models, rebuilt from events so no foreign keys
+CREATE TABLE IF NOT EXISTS user_activity (
+    event_id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    ledger_id UUID,
+    event_data JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_activity_user_created_at ON user_activity(user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS ledger_daily_spending (
+    ledger_id UUID NOT NULL,
+    day DATE NOT NULL,
+    category VARCHAR(100) NOT NULL DEFAULT '',
+    total BIGINT NOT NULL DEFAULT 0,
+    expense_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (ledger_id, day, category)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS ledger_daily_spending;
+DROP TABLE IF EXISTS user_activity;
+DROP TABLE IF EXISTS projection_checkpoints;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS ledger_activity_reads (
+    ledger_id UUID NOT NULL REFERENCES ledgers(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_read_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (ledger_id, user_id)
+);
+
+-- the activity feed filters events by ledger, recorded in the metadata and,
+-- for events older than that, in the data
+CREATE INDEX IF NOT EXISTS idx_events_metadata_ledger_id ON events((event_metadata->>'ledger_id'), created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_events_data_ledger_id ON events((event_data->>'ledger_id'), created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_events_data_ledger_id;
+DROP INDEX IF EXISTS idx_events_metadata_ledger_id;
+DROP TABLE IF EXISTS ledger_activity_reads;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sessions ADD COLUMN token_hash VARCHAR(64);
+
+-- existing sessions keep working, their cookies hash to the same value
+UPDATE sessions SET token_hash = encode(sha256(convert_to(token, 'UTF8')), 'hex');
+
+ALTER TABLE sessions ALTER COLUMN token_hash SET NOT NULL;
+ALTER TABLE sessions ADD CONSTRAINT sessions_token_hash_key UNIQUE (token_hash);
+
+DROP INDEX IF EXISTS idx_sessions_token;
+ALTER TABLE sessions DROP COLUMN token;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- the tokens can't be recovered from their hashes, everyone logs in again
+DELETE FROM sessions;
+
+ALTER TABLE sessions ADD COLUMN token VARCHAR(255) UNIQUE NOT NULL;
+CREATE INDEX idx_sessions_token ON sessions(token);
+
+ALTER TABLE sessions DROP COLUMN token_hash;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+-- when the row was inserted, as opposed to created_at, when the event
+-- happened. Events reach the table late through spill replays and the
+-- outbox relay, projections follow this order so they don't miss them.
+ALTER TABLE events ADD COLUMN IF NOT EXISTS recorded_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE events SET recorded_at = created_at WHERE recorded_at IS NULL;
+
+ALTER TABLE events ALTER COLUMN recorded_at SET DEFAULT clock_timestamp();
+ALTER TABLE events ALTER COLUMN recorded_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_events_recorded_at ON events(recorded_at, id);
+
+-- the checkpoints stay valid, recorded_at was backfilled from created_at
+ALTER TABLE projection_checkpoints RENAME COLUMN last_created_at TO last_recorded_at;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE projection_checkpoints RENAME COLUMN last_recorded_at TO last_created_at;
+
+DROP INDEX IF EXISTS idx_events_recorded_at;
+ALTER TABLE events DROP COLUMN IF EXISTS recorded_at;
+-- +goose StatementEnd
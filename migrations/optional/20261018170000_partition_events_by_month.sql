@@ -0,0 +1,83 @@
+-- Optional: turns events into a table partitioned by month, so expired
+-- months can be dropped whole. Run with "task partition-events". The app
+-- creates upcoming partitions as it prunes.
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE events RENAME TO events_unpartitioned;
+ALTER TABLE events_unpartitioned RENAME CONSTRAINT events_pkey TO events_unpartitioned_pkey;
+DROP INDEX IF EXISTS idx_events_type;
+DROP INDEX IF EXISTS idx_events_created_at;
+DROP INDEX IF EXISTS idx_events_type_created_at;
+
+-- the partition key has to be part of the primary key
+CREATE TABLE events (
+    id UUID NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    event_data JSONB,
+    event_metadata JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (id, created_at)
+) PARTITION BY RANGE (created_at);
+
+CREATE INDEX idx_events_created_at ON events(created_at DESC);
+CREATE INDEX idx_events_type_created_at ON events(event_type, created_at DESC);
+
+CREATE TABLE events_default PARTITION OF events DEFAULT;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DO $$
+DECLARE
+    month DATE;
+BEGIN
+    FOR month IN
+        SELECT generate_series(
+            date_trunc('month', COALESCE((SELECT min(created_at) FROM events_unpartitioned), now()) AT TIME ZONE 'UTC'),
+            date_trunc('month', now() AT TIME ZONE 'UTC') + INTERVAL '2 months',
+            INTERVAL '1 month'
+        )::DATE
+    LOOP
+        EXECUTE format(
+            'CREATE TABLE %I PARTITION OF events FOR VALUES FROM (%L) TO (%L)',
+            'events_' || to_char(month, 'YYYY_MM'),
+            month::TIMESTAMP AT TIME ZONE 'UTC',
+            (month + INTERVAL '1 month')::TIMESTAMP AT TIME ZONE 'UTC'
+        );
+    END LOOP;
+END
+$$;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO events (id, event_type, event_data, event_metadata, created_at)
+SELECT id, event_type, event_data, event_metadata, created_at FROM events_unpartitioned;
+
+DROP TABLE events_unpartitioned;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE events RENAME TO events_partitioned;
+ALTER TABLE events_partitioned RENAME CONSTRAINT events_pkey TO events_partitioned_pkey;
+DROP INDEX IF EXISTS idx_events_created_at;
+DROP INDEX IF EXISTS idx_events_type_created_at;
+
+CREATE TABLE events (
+    id UUID PRIMARY KEY,
+    event_type VARCHAR(100) NOT NULL,
+    event_data JSONB,
+    event_metadata JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_events_type ON events(event_type);
+CREATE INDEX IF NOT EXISTS idx_events_created_at ON events(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_events_type_created_at ON events(event_type, created_at DESC);
+
+INSERT INTO events (id, event_type, event_data, event_metadata, created_at)
+SELECT id, event_type, event_data, event_metadata, created_at FROM events_partitioned
+ON CONFLICT DO NOTHING;
+
+DROP TABLE events_partitioned;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- Optional: partitioning after the activity feed migration drops its
+-- indexes with the old table, this creates them on the partitioned one.
+
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS idx_events_metadata_ledger_id ON events((event_metadata->>'ledger_id'), created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_events_data_ledger_id ON events((event_data->>'ledger_id'), created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- the regular migrations own the indexes, nothing to undo
+SELECT 1;
+-- +goose StatementEnd
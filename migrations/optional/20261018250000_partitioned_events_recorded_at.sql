@@ -0,0 +1,22 @@
+-- Optional: partitioning copies the events into a new table that doesn't
+-- have the recorded_at column the regular migrations add, this puts it
+-- back. Events recorded while partitioning are treated as recorded when
+-- they were created.
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE events ADD COLUMN IF NOT EXISTS recorded_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE events SET recorded_at = created_at WHERE recorded_at IS NULL;
+
+ALTER TABLE events ALTER COLUMN recorded_at SET DEFAULT clock_timestamp();
+ALTER TABLE events ALTER COLUMN recorded_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_events_recorded_at ON events(recorded_at, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- the regular migrations own the column, nothing to undo
+SELECT 1;
+-- +goose StatementEnd
@@ -0,0 +1,86 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// prefixLen is the hash prefix length of the Pwned Passwords range API
+const prefixLen = 5
+
+// BreachedList holds SHA-1 hashes of breached passwords grouped by their
+// 5 character prefix, the same k-anonymity split as the Pwned Passwords
+// range API, so a lookup only ever touches one small bucket
+type BreachedList struct {
+	buckets map[string][]string
+}
+
+// LoadBreached reads a file with one uppercase or lowercase SHA-1 hash per
+// line, optionally followed by ":count" as in the Pwned Passwords
+// downloads. Blank lines and lines starting with # are skipped.
+func LoadBreached(path string) (*BreachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := &BreachedList{buckets: make(map[string][]string)}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(text, ":")
+		hash = strings.ToUpper(hash)
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("%s:%d: not a SHA-1 hash", path, line)
+		}
+		prefix := hash[:prefixLen]
+		list.buckets[prefix] = append(list.buckets[prefix], hash[prefixLen:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, suffixes := range list.buckets {
+		slices.Sort(suffixes)
+	}
+
+	return list, nil
+}
+
+// Contains reports whether the password is on the list. A nil list
+// contains nothing.
+func (l *BreachedList) Contains(password string) bool {
+	if l == nil {
+		return false
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	_, found := slices.BinarySearch(l.buckets[hash[:prefixLen]], hash[prefixLen:])
+	return found
+}
+
+// Len returns how many hashes the list holds
+func (l *BreachedList) Len() int {
+	if l == nil {
+		return 0
+	}
+
+	n := 0
+	for _, suffixes := range l.buckets {
+		n += len(suffixes)
+	}
+	return n
+}
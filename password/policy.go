@@ -0,0 +1,58 @@
+// Package password decides whether a new password is acceptable: long
+// enough, hard enough to guess and not known from a breach.
+package password
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+var (
+	ErrTooShort = errors.New("password is too short")
+	ErrTooLong  = errors.New("password is too long")
+	ErrTooWeak  = errors.New("password is too easy to guess")
+	ErrBreached = errors.New("password has appeared in a data breach")
+)
+
+// bcrypt ignores anything past 72 bytes, so longer passwords would be
+// silently truncated
+const maxBytes = 72
+
+// Policy is what a new password must satisfy. MinScore goes from 0 to 4,
+// see Strength. A nil Breached list skips the breach check.
+type Policy struct {
+	MinLength int
+	MinScore  int
+	Breached  *BreachedList
+}
+
+func DefaultPolicy() Policy {
+	return Policy{MinLength: 10, MinScore: 2}
+}
+
+// Check returns why the password isn't acceptable, or nil. userInputs are
+// things like the email, which make a password easier to guess when used in it.
+func (p Policy) Check(password string, userInputs ...string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w, use at least %d characters", ErrTooShort, p.MinLength)
+	}
+	if len(password) > maxBytes {
+		return fmt.Errorf("%w, use at most %d characters", ErrTooLong, maxBytes)
+	}
+	if p.Breached.Contains(password) {
+		return fmt.Errorf("%w, choose another one", ErrBreached)
+	}
+	if Strength(password, userInputs...) < p.MinScore {
+		return fmt.Errorf("%w, add more words and avoid common passwords, names and sequences", ErrTooWeak)
+	}
+
+	return nil
+}
+
+// IsRejected reports whether err is the policy turning a password down,
+// something the user can fix by choosing another one
+func IsRejected(err error) bool {
+	return errors.Is(err, ErrTooShort) || errors.Is(err, ErrTooLong) ||
+		errors.Is(err, ErrTooWeak) || errors.Is(err, ErrBreached)
+}
@@ -0,0 +1,301 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Strength estimates how hard the password is to guess, in the spirit of
+// zxcvbn: it's split into the cheapest patterns an attacker would try
+// first (common passwords and words, the user's own details, repeats,
+// sequences, keyboard walks and years) and whatever is left over is
+// brute forced. The score goes from 0, too guessable, to 4, very
+// unguessable.
+func Strength(password string, userInputs ...string) int {
+	guesses := log10Guesses(password, userInputs)
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// log10Guesses is the base 10 logarithm of the estimated guesses, which
+// keeps long passwords from overflowing
+func log10Guesses(password string, userInputs []string) float64 {
+	original := []rune(password)
+	lower := make([]rune, len(original))
+	unleeted := make([]rune, len(original))
+	for i, r := range original {
+		lower[i] = unicode.ToLower(r)
+		unleeted[i] = unleet(lower[i])
+	}
+
+	if rank, ok := commonRanks[string(lower)]; ok {
+		return math.Log10(float64(rank))
+	}
+	if rank, ok := commonRanks[string(unleeted)]; ok {
+		return math.Log10(float64(rank) * 2)
+	}
+
+	words := dictionary(userInputs)
+	card := math.Log10(float64(cardinality(original)))
+
+	// least guesses to get the first i characters, trying at each position
+	// every pattern that starts there as well as brute forcing one character
+	least := make([]float64, len(original)+1)
+	for i := 1; i < len(least); i++ {
+		least[i] = math.Inf(1)
+	}
+	for i := range original {
+		relax := func(length int, log10 float64) {
+			if length > 0 && least[i]+log10 < least[i+length] {
+				least[i+length] = least[i] + log10
+			}
+		}
+
+		relax(1, card)
+		for _, m := range dictionaryMatches(original, lower, unleeted, i, words) {
+			relax(m.length, math.Log10(m.guesses))
+		}
+		for _, matcher := range []func([]rune, int) (int, float64){repeatMatch, sequenceMatch, keyboardMatch, yearMatch} {
+			if length, guesses := matcher(lower, i); length > 0 {
+				relax(length, math.Log10(guesses))
+			}
+		}
+	}
+
+	return least[len(original)]
+}
+
+type match struct {
+	length  int
+	guesses float64
+}
+
+func dictionaryMatches(original, lower, unleeted []rune, i int, words map[string]int) []match {
+	var matches []match
+	for end := i + minWordLen; end <= len(lower); end++ {
+		guesses := 0.0
+		if rank, ok := words[string(lower[i:end])]; ok {
+			guesses = float64(rank)
+		} else if rank, ok := words[string(unleeted[i:end])]; ok {
+			guesses = float64(rank) * 2
+		} else {
+			continue
+		}
+		matches = append(matches, match{end - i, guesses * uppercaseVariations(original[i:end])})
+	}
+	return matches
+}
+
+// uppercaseVariations is how many more guesses capitalizing a word costs.
+// Capitalizing the first letter, or all of them, is what people usually do.
+func uppercaseVariations(word []rune) float64 {
+	upper := 0
+	for _, r := range word {
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 1
+	case upper == len(word) || (upper == 1 && unicode.IsUpper(word[0])):
+		return 2
+	default:
+		return math.Pow(2, float64(min(upper, 10)))
+	}
+}
+
+func repeatMatch(lower []rune, i int) (int, float64) {
+	end := i + 1
+	for end < len(lower) && lower[end] == lower[i] {
+		end++
+	}
+	if end-i < 3 {
+		return 0, 0
+	}
+	return end - i, float64(cardinality(lower[i:i+1]) * (end - i))
+}
+
+func sequenceMatch(lower []rune, i int) (int, float64) {
+	if i+1 >= len(lower) {
+		return 0, 0
+	}
+	delta := lower[i+1] - lower[i]
+	if delta != 1 && delta != -1 {
+		return 0, 0
+	}
+
+	end := i + 2
+	for end < len(lower) && lower[end]-lower[end-1] == delta {
+		end++
+	}
+	if end-i < 3 {
+		return 0, 0
+	}
+
+	base := 26.0
+	if unicode.IsDigit(lower[i]) {
+		base = 10
+	}
+	if delta < 0 {
+		base *= 2
+	}
+	return end - i, base * float64(end-i)
+}
+
+// keyboardRows are the rows of a QWERTY layout, walking along one of them
+// is almost as guessable as a sequence
+var keyboardRows = []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"}
+
+var keyboardPositions = func() map[rune][2]int {
+	positions := make(map[rune][2]int)
+	for row, keys := range keyboardRows {
+		for col, key := range []rune(keys) {
+			positions[key] = [2]int{row, col}
+		}
+	}
+	return positions
+}()
+
+func keyboardMatch(lower []rune, i int) (int, float64) {
+	adjacent := func(a, b rune) bool {
+		pa, okA := keyboardPositions[a]
+		pb, okB := keyboardPositions[b]
+		return okA && okB && pa[0] == pb[0] && (pa[1]-pb[1] == 1 || pb[1]-pa[1] == 1)
+	}
+
+	end := i + 1
+	for end < len(lower) && adjacent(lower[end-1], lower[end]) {
+		end++
+	}
+	if end-i < 4 {
+		return 0, 0
+	}
+	return end - i, 40 * float64(end-i)
+}
+
+func yearMatch(lower []rune, i int) (int, float64) {
+	if i+4 > len(lower) {
+		return 0, 0
+	}
+	year := string(lower[i : i+4])
+	if year >= "1900" && year <= "2099" && strings.IndexFunc(year, func(r rune) bool { return !unicode.IsDigit(r) }) == -1 {
+		return 4, 200
+	}
+	return 0, 0
+}
+
+// cardinality is the size of the alphabet a brute force attack on the
+// password would have to go through
+func cardinality(password []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	n := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			n += class.size
+		}
+	}
+	return max(n, 1)
+}
+
+var leetSubstitutions = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+	'@': 'a', '$': 's', '!': 'i', '|': 'l', '+': 't',
+}
+
+func unleet(r rune) rune {
+	if sub, ok := leetSubstitutions[r]; ok {
+		return sub
+	}
+	return r
+}
+
+// minWordLen keeps short fragments like "an" from counting as words
+const minWordLen = 3
+
+// dictionary is the common words plus the user's own details, which rank
+// first since they're the first thing someone targeting the user tries
+func dictionary(userInputs []string) map[string]int {
+	if len(userInputs) == 0 {
+		return commonRanks
+	}
+
+	words := make(map[string]int, len(commonRanks)+len(userInputs)*3)
+	for word, rank := range commonRanks {
+		words[word] = rank
+	}
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		parts := strings.FieldsFunc(input, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range append(parts, input) {
+			if len([]rune(word)) >= minWordLen {
+				words[word] = 1
+			}
+		}
+	}
+	return words
+}
+
+// commonWords are frequent passwords, and words people build them from,
+// roughly most frequent first
+var commonWords = []string{
+	"123456", "password", "123456789", "12345678", "12345", "qwerty", "1234567",
+	"111111", "123123", "senha", "abc123", "1234567890", "000000", "iloveyou",
+	"admin", "welcome", "monkey", "dragon", "letmein", "football", "futebol",
+	"master", "sunshine", "princess", "qwertyuiop", "654321", "superman",
+	"batman", "trustno1", "passw0rd", "password1", "senha123", "mudar123",
+	"brasil", "flamengo", "corinthians", "palmeiras", "saopaulo", "gremio",
+	"vasco", "santos", "cruzeiro", "botafogo", "fluminense", "internacional",
+	"amor", "teamo", "familia", "deus", "jesus", "casa", "acasinha", "despesas",
+	"expenses", "love", "secret", "shadow", "baseball", "michael", "charlie",
+	"jordan", "hunter", "killer", "soccer", "hello", "freedom", "whatever",
+	"computer", "internet", "starwars", "pokemon", "naruto", "minecraft",
+	"summer", "winter", "spring", "autumn", "verao", "inverno", "janeiro",
+	"fevereiro", "marco", "abril", "maio", "junho", "julho", "agosto",
+	"setembro", "outubro", "novembro", "dezembro", "maria", "joao", "jose",
+	"ana", "pedro", "lucas", "gabriel", "rafael", "daniel", "bruno", "carlos",
+	"paulo", "mateus", "julia", "beatriz", "juliana", "fernanda", "amanda",
+	"money", "dinheiro", "house", "family", "friend", "amigo", "test", "teste",
+	"guest", "user", "login", "root", "access", "default", "changeme",
+}
+
+var commonRanks = func() map[string]int {
+	ranks := make(map[string]int, len(commonWords))
+	for i, word := range commonWords {
+		if _, ok := ranks[word]; !ok {
+			ranks[word] = i + 1
+		}
+	}
+	return ranks
+}()
@@ -0,0 +1,18 @@
+// Package projections lists the read models built from events, so the
+// server and the rebuild command project the same ones
+package projections
+
+import (
+	"time"
+
+	"github.com/billbatista/acasinha-expenses/eventlogger"
+	"github.com/billbatista/acasinha-expenses/ledger"
+	"github.com/billbatista/acasinha-expenses/user"
+)
+
+func All() []eventlogger.Projection {
+	return []eventlogger.Projection{
+		user.NewActivityProjection(),
+		ledger.NewDailySpendingProjection(time.Local),
+	}
+}
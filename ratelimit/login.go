@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// LoginPolicy is how many failed logins are tolerated. Failures count in a
+// sliding Window per client IP and per account; past MaxAccountFailures the
+// account is locked for Lockout, past MaxIPFailures the IP is turned away
+// until its failures slide out of the window. Every failure on an account
+// also doubles the wait before its next attempt is answered, from BaseDelay
+// up to MaxDelay.
+type LoginPolicy struct {
+	Window             time.Duration
+	MaxIPFailures      int
+	MaxAccountFailures int
+	Lockout            time.Duration
+	BaseDelay          time.Duration
+	MaxDelay           time.Duration
+}
+
+func DefaultLoginPolicy() LoginPolicy {
+	return LoginPolicy{
+		Window:             15 * time.Minute,
+		MaxIPFailures:      50,
+		MaxAccountFailures: 5,
+		Lockout:            15 * time.Minute,
+		BaseDelay:          250 * time.Millisecond,
+		MaxDelay:           4 * time.Second,
+	}
+}
+
+// LoginDecision is whether a login attempt may go ahead. When it can't,
+// RetryAfter says for how long; when it can, Delay is how long to wait
+// before answering it.
+type LoginDecision struct {
+	Allowed    bool
+	RetryAfter time.Duration
+	Delay      time.Duration
+
+	// at is when the attempt was recorded, failures how many the account
+	// has in the window with it
+	at       time.Time
+	failures int
+}
+
+type LoginLimiter struct {
+	store  Store
+	policy LoginPolicy
+	now    func() time.Time
+}
+
+func NewLoginLimiter(store Store, policy LoginPolicy) *LoginLimiter {
+	return &LoginLimiter{store: store, policy: policy, now: time.Now}
+}
+
+// Attempt decides on a login attempt before the password or the second
+// factor is looked at, and when it's allowed records it as a failure right
+// away, so parallel guesses can't all get in before any of them is counted.
+// The attempt stays a failure unless Success is called for it. The account
+// is the normalized email, whether or not there's a user with it, so
+// lockouts don't give away which emails have accounts.
+func (l *LoginLimiter) Attempt(ctx context.Context, ip, account string) (LoginDecision, error) {
+	now := l.now()
+
+	until, err := l.store.LockedUntil(ctx, accountKey(account), now)
+	if err != nil {
+		return LoginDecision{}, err
+	}
+	if !until.IsZero() {
+		return LoginDecision{RetryAfter: until.Sub(now)}, nil
+	}
+
+	_, ok, err := l.store.Take(ctx, ipKey(ip), now, l.policy.Window, l.policy.MaxIPFailures)
+	if err != nil {
+		return LoginDecision{}, err
+	}
+	if !ok {
+		return LoginDecision{RetryAfter: l.policy.Window}, nil
+	}
+
+	failures, ok, err := l.store.Take(ctx, accountKey(account), now, l.policy.Window, l.policy.MaxAccountFailures)
+	if err != nil {
+		return LoginDecision{}, err
+	}
+	if !ok {
+		// the account is about to be locked by the attempts still running,
+		// this one didn't happen as far as the IP is concerned
+		if err := l.store.Undo(ctx, ipKey(ip), now); err != nil {
+			return LoginDecision{}, err
+		}
+		return LoginDecision{RetryAfter: l.policy.Lockout}, nil
+	}
+
+	return LoginDecision{Allowed: true, Delay: l.delay(failures - 1), at: now, failures: failures}, nil
+}
+
+// Failure settles an allowed attempt as failed. It returns how many failures
+// the account has in the window, and when it's locked until if this one
+// locked it.
+func (l *LoginLimiter) Failure(ctx context.Context, account string, d LoginDecision) (int, time.Time, error) {
+	if d.failures < l.policy.MaxAccountFailures {
+		return d.failures, time.Time{}, nil
+	}
+
+	until := d.at.Add(l.policy.Lockout)
+	if err := l.store.Lock(ctx, accountKey(account), until); err != nil {
+		return d.failures, time.Time{}, err
+	}
+	return d.failures, until, nil
+}
+
+// Success settles an allowed attempt as the end of a full login: the account
+// failures are forgotten and the attempt no longer counts against the IP,
+// the IP's earlier failures still do
+func (l *LoginLimiter) Success(ctx context.Context, ip, account string, d LoginDecision) error {
+	if err := l.store.Reset(ctx, accountKey(account)); err != nil {
+		return err
+	}
+	return l.store.Undo(ctx, ipKey(ip), d.at)
+}
+
+func (l *LoginLimiter) delay(failures int) time.Duration {
+	if failures == 0 {
+		return 0
+	}
+	delay := l.policy.BaseDelay
+	for i := 1; i < failures && delay < l.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, l.policy.MaxDelay)
+}
+
+func ipKey(ip string) string {
+	return "login:ip:" + ip
+}
+
+func accountKey(account string) string {
+	return "login:account:" + account
+}
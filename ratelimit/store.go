@@ -0,0 +1,144 @@
+// Package ratelimit counts attempts per key in a sliding window and locks
+// keys out for a while, to slow down password guessing
+package ratelimit
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Store keeps the attempts and lockouts. MemoryStore is enough for a single
+// instance; running several needs a shared one, e.g. on Redis or Postgres.
+type Store interface {
+	// Take records an attempt for key at now unless there were already limit
+	// attempts in the window ending at now. Checking and recording happen
+	// in one step, so parallel attempts can't get past the limit. It returns
+	// how many attempts there are in the window, this one included, and
+	// whether it was recorded.
+	Take(ctx context.Context, key string, now time.Time, window time.Duration, limit int) (int, bool, error)
+	// Undo forgets the attempt Take recorded for key at the given time
+	Undo(ctx context.Context, key string, at time.Time) error
+	// Lock rejects key until the given time
+	Lock(ctx context.Context, key string, until time.Time) error
+	// LockedUntil returns when the lock on key ends, the zero time if there's none
+	LockedUntil(ctx context.Context, key string, now time.Time) (time.Time, error)
+	// Reset forgets the attempts and lock of key
+	Reset(ctx context.Context, key string) error
+}
+
+type memoryStore struct {
+	mu        sync.Mutex
+	attempts  map[string][]time.Time
+	locks     map[string]time.Time
+	lastSweep time.Time
+	// maxWindow is the longest window seen, attempts older than it can go
+	maxWindow time.Duration
+}
+
+// NewMemoryStore keeps everything in the process memory, it's lost on restart
+func NewMemoryStore() *memoryStore {
+	return &memoryStore{
+		attempts: make(map[string][]time.Time),
+		locks:    make(map[string]time.Time),
+	}
+}
+
+func (s *memoryStore) Take(ctx context.Context, key string, now time.Time, window time.Duration, limit int) (int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxWindow = max(s.maxWindow, window)
+	s.sweep(now)
+
+	n := countSince(s.attempts[key], now.Add(-window))
+	if n >= limit {
+		return n, false, nil
+	}
+	// now is taken by the caller before the lock, so a concurrent call may
+	// have recorded a later time already; keep the times in ascending order
+	// for countSince and sweep
+	times := s.attempts[key]
+	i, _ := slices.BinarySearchFunc(times, now, func(t, now time.Time) int { return t.Compare(now) })
+	s.attempts[key] = slices.Insert(times, i, now)
+	return n + 1, true, nil
+}
+
+func (s *memoryStore) Undo(ctx context.Context, key string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	times := s.attempts[key]
+	for i := len(times) - 1; i >= 0; i-- {
+		if times[i].Equal(at) {
+			s.attempts[key] = append(times[:i], times[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.locks[key] = until
+	return nil
+}
+
+func (s *memoryStore) LockedUntil(ctx context.Context, key string, now time.Time) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.locks[key]
+	if !ok || !until.After(now) {
+		return time.Time{}, nil
+	}
+	return until, nil
+}
+
+func (s *memoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	delete(s.locks, key)
+	return nil
+}
+
+// sweep drops attempts and locks nobody can be affected by anymore, at most
+// once per window so guessing across many keys can't grow memory forever
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.maxWindow {
+		return
+	}
+	s.lastSweep = now
+
+	cutoff := now.Add(-s.maxWindow)
+	for key, times := range s.attempts {
+		i := 0
+		for i < len(times) && !times[i].After(cutoff) {
+			i++
+		}
+		if i == len(times) {
+			delete(s.attempts, key)
+		} else {
+			s.attempts[key] = times[i:]
+		}
+	}
+	for key, until := range s.locks {
+		if !until.After(now) {
+			delete(s.locks, key)
+		}
+	}
+}
+
+// countSince counts the times after since, which are in ascending order
+func countSince(times []time.Time, since time.Time) int {
+	n := 0
+	for i := len(times) - 1; i >= 0 && times[i].After(since); i-- {
+		n++
+	}
+	return n
+}
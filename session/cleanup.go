@@ -0,0 +1,55 @@
+package session
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Cleaner deletes expired sessions every interval, they're rejected anyway
+// but would pile up in the table otherwise
+type Cleaner struct {
+	repo     Repository
+	interval time.Duration
+	wg       sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+func NewCleaner(repo Repository, interval time.Duration) *Cleaner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Cleaner{
+		repo:     repo,
+		interval: interval,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+func (c *Cleaner) Start() {
+	c.wg.Go(func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			n, err := c.repo.DeleteExpired(c.ctx, time.Now())
+			if err != nil {
+				slog.Error("failed to delete expired sessions", "error", err)
+			} else if n > 0 {
+				slog.Info("deleted expired sessions", "count", n)
+			}
+
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+func (c *Cleaner) Shutdown() {
+	c.cancel()
+	c.wg.Wait()
+}
@@ -3,8 +3,10 @@ package session
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
+	"encoding/hex"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,30 +20,37 @@ func NewRepository(db *sql.DB) *repository {
 	return &repository{db: db}
 }
 
-func (r *repository) Create(ctx context.Context, userID uuid.UUID) (*Session, error) {
+func (r *repository) Create(ctx context.Context, userID uuid.UUID, userAgent, ip string) (*Session, error) {
 	token, err := generateSecureToken()
 	if err != nil {
 		return nil, err
 	}
 
+	now := time.Now()
 	session := &Session{
-		ID:        uuid.New(),
-		UserID:    userID,
-		Token:     token,
-		ExpiresAt: time.Now().Add(sessionDuration),
-		CreatedAt: time.Now(),
+		ID:         uuid.New(),
+		UserID:     userID,
+		Token:      token,
+		UserAgent:  userAgent,
+		IP:         ip,
+		ExpiresAt:  expiresAt(now, now),
+		LastSeenAt: now,
+		CreatedAt:  now,
 	}
 
 	query := `
-        INSERT INTO sessions (id, user_id, token, expires_at, created_at)
-        VALUES ($1, $2, $3, $4, $5)
+        INSERT INTO sessions (id, user_id, token_hash, user_agent, ip, expires_at, last_seen_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
     `
 
 	_, err = r.db.ExecContext(ctx, query,
 		session.ID,
 		session.UserID,
-		session.Token,
+		hashToken(session.Token),
+		session.UserAgent,
+		session.IP,
 		session.ExpiresAt,
+		session.LastSeenAt,
 		session.CreatedAt,
 	)
 	if err != nil {
@@ -53,21 +62,13 @@ func (r *repository) Create(ctx context.Context, userID uuid.UUID) (*Session, er
 
 // GetByToken retrieves a session by token and validates it's not expired
 func (r *repository) GetByToken(ctx context.Context, token string) (*Session, error) {
-	var session Session
-
 	query := `
-        SELECT id, user_id, token, expires_at, created_at
+        SELECT id, user_id, user_agent, ip, expires_at, last_seen_at, created_at
         FROM sessions
-        WHERE token = $1
+        WHERE token_hash = $1
     `
 
-	err := r.db.QueryRowContext(ctx, query, token).Scan(
-		&session.ID,
-		&session.UserID,
-		&session.Token,
-		&session.ExpiresAt,
-		&session.CreatedAt,
-	)
+	session, err := scanSession(r.db.QueryRowContext(ctx, query, hashToken(token)))
 	if err != nil && err == sql.ErrNoRows {
 		return nil, ErrInvalidSession
 	}
@@ -79,16 +80,108 @@ func (r *repository) GetByToken(ctx context.Context, token string) (*Session, er
 		return nil, ErrExpiredSession
 	}
 
-	return &session, nil
+	return session, nil
+}
+
+// Touch records that the session was just used, from ip, and slides its
+// expiration. It returns the new expiration for the cookie.
+func (r *repository) Touch(ctx context.Context, id uuid.UUID, ip string) (time.Time, error) {
+	query := `
+        UPDATE sessions
+        SET last_seen_at = $1, ip = $2,
+            expires_at = LEAST($1 + make_interval(secs => $3), created_at + make_interval(secs => $4))
+        WHERE id = $5
+        RETURNING expires_at
+    `
+
+	var expires time.Time
+	err := r.db.QueryRowContext(ctx, query, time.Now(), ip, IdleTimeout.Seconds(), MaxLifetime.Seconds(), id).Scan(&expires)
+	if err == sql.ErrNoRows {
+		return time.Time{}, ErrNotFound
+	}
+	return expires, err
+}
+
+// Rotate gives the session a new token, the old one stops working. Done
+// when the user's privileges change so a token stolen before can't ride on
+// them.
+func (r *repository) Rotate(ctx context.Context, id uuid.UUID) (*Session, error) {
+	token, err := generateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        UPDATE sessions SET token_hash = $1
+        WHERE id = $2 AND expires_at > NOW()
+        RETURNING id, user_id, user_agent, ip, expires_at, last_seen_at, created_at
+    `
+
+	session, err := scanSession(r.db.QueryRowContext(ctx, query, hashToken(token), id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session.Token = token
+	return session, nil
+}
+
+// ListByUserID returns the user's sessions that haven't expired, most
+// recently used first
+func (r *repository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]Session, error) {
+	query := `
+        SELECT id, user_id, user_agent, ip, expires_at, last_seen_at, created_at
+        FROM sessions
+        WHERE user_id = $1 AND expires_at > NOW()
+        ORDER BY last_seen_at DESC
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, rows.Err()
 }
 
 // Delete removes a session (logout)
 func (r *repository) Delete(ctx context.Context, token string) error {
-	query := `DELETE FROM sessions WHERE token = $1`
-	_, err := r.db.ExecContext(ctx, query, token)
+	query := `DELETE FROM sessions WHERE token_hash = $1`
+	_, err := r.db.ExecContext(ctx, query, hashToken(token))
 	return err
 }
 
+// DeleteByID removes one of the user's sessions, signing that device out
+func (r *repository) DeleteByID(ctx context.Context, userID, id uuid.UUID) error {
+	query := `DELETE FROM sessions WHERE id = $1 AND user_id = $2`
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 // DeleteByUserID removes all sessions for a user
 func (r *repository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
 	query := `DELETE FROM sessions WHERE user_id = $1`
@@ -96,6 +189,45 @@ func (r *repository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error
 	return err
 }
 
+// DeleteOthers removes all sessions for a user except the one with keepID,
+// signing them out everywhere else
+func (r *repository) DeleteOthers(ctx context.Context, userID, keepID uuid.UUID) error {
+	query := `DELETE FROM sessions WHERE user_id = $1 AND id <> $2`
+	_, err := r.db.ExecContext(ctx, query, userID, keepID)
+	return err
+}
+
+// DeleteExpired removes the sessions expired as of now, returning how many
+func (r *repository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	query := `DELETE FROM sessions WHERE expires_at <= $1`
+	result, err := r.db.ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSession(row scanner) (*Session, error) {
+	var session Session
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IP,
+		&session.ExpiresAt,
+		&session.LastSeenAt,
+		&session.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
 func generateSecureToken() (string, error) {
 	b := make([]byte, 32)
 	_, err := rand.Read(b)
@@ -104,3 +236,8 @@ func generateSecureToken() (string, error) {
 	}
 	return base64.URLEncoding.EncodeToString(b), nil
 }
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -3,6 +3,8 @@ package session
 import (
 	"context"
 	"errors"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,24 +13,97 @@ import (
 var (
 	ErrInvalidSession = errors.New("invalid session")
 	ErrExpiredSession = errors.New("session expired")
+	ErrNotFound       = errors.New("session not found")
 )
 
 const (
-	sessionDuration = 7 * 24 * time.Hour
-	CookieName      = "session_token"
+	// IdleTimeout is how long a session lasts without being used, every
+	// use pushes its expiration this far again
+	IdleTimeout = 7 * 24 * time.Hour
+	// MaxLifetime is how long a session lasts however much it's used
+	MaxLifetime = 30 * 24 * time.Hour
+	CookieName  = "session_token"
+	// TouchInterval is how stale LastSeenAt may get before a request
+	// updates it, so not every request writes to the database
+	TouchInterval = time.Minute
 )
 
 type Session struct {
-	ID        uuid.UUID
-	UserID    uuid.UUID
-	Token     string
-	ExpiresAt time.Time
-	CreatedAt time.Time
+	ID     uuid.UUID
+	UserID uuid.UUID
+	// Token is only set when the session is created or rotated, the
+	// database keeps just its hash
+	Token      string
+	UserAgent  string
+	IP         string
+	ExpiresAt  time.Time
+	LastSeenAt time.Time
+	CreatedAt  time.Time
 }
 
 type Repository interface {
-	Create(ctx context.Context, userID uuid.UUID) (*Session, error)
+	Create(ctx context.Context, userID uuid.UUID, userAgent, ip string) (*Session, error)
 	GetByToken(ctx context.Context, token string) (*Session, error)
+	Touch(ctx context.Context, id uuid.UUID, ip string) (time.Time, error)
+	Rotate(ctx context.Context, id uuid.UUID) (*Session, error)
+	ListByUserID(ctx context.Context, userID uuid.UUID) ([]Session, error)
 	Delete(ctx context.Context, token string) error
+	DeleteByID(ctx context.Context, userID, id uuid.UUID) error
 	DeleteByUserID(ctx context.Context, userID uuid.UUID) error
+	DeleteOthers(ctx context.Context, userID, keepID uuid.UUID) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// Cookie is the cookie carrying token to the browser until expires
+func Cookie(token string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     CookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   false,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// expiresAt is when a session used at now expires, IdleTimeout later but
+// never past MaxLifetime since it was created
+func expiresAt(createdAt, now time.Time) time.Time {
+	idle := now.Add(IdleTimeout)
+	if limit := createdAt.Add(MaxLifetime); idle.After(limit) {
+		return limit
+	}
+	return idle
+}
+
+// Device describes the browser and system from the user agent, like
+// "Firefox no Linux", for people to recognize their sessions
+func (s *Session) Device() string {
+	ua := s.UserAgent
+	if ua == "" {
+		return "Dispositivo desconhecido"
+	}
+
+	browser := "Navegador desconhecido"
+	// order matters, Edge and Opera also say Chrome, Chrome also says Safari
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"}, {"Safari/", "Safari"}, {"curl/", "curl"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	for _, system := range []struct{ token, name string }{
+		{"iPhone", "iPhone"}, {"iPad", "iPad"}, {"Android", "Android"},
+		{"Windows", "Windows"}, {"Mac OS X", "macOS"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"},
+	} {
+		if strings.Contains(ua, system.token) {
+			return browser + " no " + system.name
+		}
+	}
+	return browser
 }
@@ -0,0 +1,19 @@
+// Package settings stores application wide settings admins can change at
+// runtime, as opposed to the environment read at startup
+package settings
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// TwoFactorRequired makes every account set up two-factor authentication
+// before using the app
+const TwoFactorRequired = "two_factor_required"
+
+type Repository interface {
+	// Bool returns the setting as a boolean, false when it's never been set
+	Bool(ctx context.Context, key string) (bool, error)
+	SetBool(ctx context.Context, key string, value bool, updatedBy uuid.UUID) error
+}
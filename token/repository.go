@@ -0,0 +1,221 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *repository {
+	return &repository{db: db}
+}
+
+// Create mints a new token. The plaintext is returned only here; the
+// database keeps its SHA-256 hash.
+func (r *repository) Create(ctx context.Context, userID uuid.UUID, name string, scopes []Scope, expiresAt *time.Time) (*Token, string, error) {
+	if name == "" {
+		return nil, "", ErrEmptyName
+	}
+	if utf8.RuneCountInString(name) > MaxNameLength {
+		return nil, "", ErrNameTooLong
+	}
+
+	if len(scopes) == 0 {
+		return nil, "", ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if _, err := ParseScope(string(scope)); err != nil {
+			return nil, "", err
+		}
+	}
+
+	plaintext, err := generatePlaintext()
+	if err != nil {
+		return nil, "", err
+	}
+
+	token := &Token{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    plaintext[:displayPrefixLength],
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	query := `
+        INSERT INTO personal_access_tokens (id, user_id, name, prefix, token_hash, scopes, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    `
+
+	_, err = r.db.ExecContext(ctx, query,
+		token.ID,
+		token.UserID,
+		token.Name,
+		token.Prefix,
+		hashToken(plaintext),
+		pq.Array(scopes),
+		token.ExpiresAt,
+		token.CreatedAt,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return token, plaintext, nil
+}
+
+// GetByPlaintext resolves a bearer token, rejecting revoked and expired ones
+func (r *repository) GetByPlaintext(ctx context.Context, plaintext string) (*Token, error) {
+	query := `
+        SELECT id, user_id, name, prefix, scopes, last_used_at, expires_at, revoked_at, created_at
+        FROM personal_access_tokens
+        WHERE token_hash = $1
+    `
+
+	token, err := scanToken(r.db.QueryRowContext(ctx, query, hashToken(plaintext)))
+	if err != nil && err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if token.RevokedAt != nil {
+		return nil, ErrRevokedToken
+	}
+
+	if token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt) {
+		return nil, ErrExpiredToken
+	}
+
+	return token, nil
+}
+
+func (r *repository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]Token, error) {
+	query := `
+        SELECT id, user_id, name, prefix, scopes, last_used_at, expires_at, revoked_at, created_at
+        FROM personal_access_tokens
+        WHERE user_id = $1 AND revoked_at IS NULL
+        ORDER BY created_at DESC
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []Token
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// Revoke marks the token as revoked, scoped to its owner
+func (r *repository) Revoke(ctx context.Context, userID uuid.UUID, tokenID uuid.UUID) error {
+	query := `UPDATE personal_access_tokens SET revoked_at = $1 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, time.Now().UTC(), tokenID, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RevokeAll revokes every token of the user, for when whoever has them may
+// not be the user anymore
+func (r *repository) RevokeAll(ctx context.Context, userID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, revokeAllQuery, time.Now().UTC(), userID)
+	return err
+}
+
+// RevokeAllInTx is RevokeAll within the caller's transaction, so the tokens
+// only go if the change that called for it commits
+func RevokeAllInTx(ctx context.Context, tx *sql.Tx, userID uuid.UUID) error {
+	_, err := tx.ExecContext(ctx, revokeAllQuery, time.Now().UTC(), userID)
+	return err
+}
+
+const revokeAllQuery = `UPDATE personal_access_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`
+
+// TouchLastUsed records token usage, at most once a minute to avoid a write
+// on every API call
+func (r *repository) TouchLastUsed(ctx context.Context, tokenID uuid.UUID) error {
+	query := `
+        UPDATE personal_access_tokens SET last_used_at = NOW()
+        WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+    `
+	_, err := r.db.ExecContext(ctx, query, tokenID)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanToken(row scanner) (*Token, error) {
+	var token Token
+	var scopes []string
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.Prefix,
+		pq.Array(&scopes),
+		&token.LastUsedAt,
+		&token.ExpiresAt,
+		&token.RevokedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, scope := range scopes {
+		token.Scopes = append(token.Scopes, Scope(scope))
+	}
+
+	return &token, nil
+}
+
+func generatePlaintext() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return Prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
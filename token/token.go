@@ -0,0 +1,76 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token expired")
+	ErrRevokedToken = errors.New("token revoked")
+	ErrEmptyName    = errors.New("token name can't be empty")
+	ErrNameTooLong  = fmt.Errorf("token name can't be longer than %d characters", MaxNameLength)
+	ErrInvalidScope = errors.New("invalid token scope")
+	ErrNotFound     = errors.New("token not found")
+)
+
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+)
+
+const (
+	// MaxNameLength is the most characters the name column takes
+	MaxNameLength = 100
+	// Prefix makes tokens easy to spot in configs and secret scanners
+	Prefix = "acx_"
+	// displayPrefixLength is how much of the token is kept in plaintext so
+	// users can tell their tokens apart
+	displayPrefixLength = len(Prefix) + 6
+)
+
+type Token struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	Prefix     string
+	Scopes     []Scope
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+// HasScope reports whether the token grants the scope. Write implies read.
+func (t *Token) HasScope(scope Scope) bool {
+	if slices.Contains(t.Scopes, scope) {
+		return true
+	}
+	return scope == ScopeRead && slices.Contains(t.Scopes, ScopeWrite)
+}
+
+func ParseScope(s string) (Scope, error) {
+	switch Scope(s) {
+	case ScopeRead, ScopeWrite:
+		return Scope(s), nil
+	default:
+		return "", ErrInvalidScope
+	}
+}
+
+type Repository interface {
+	Create(ctx context.Context, userID uuid.UUID, name string, scopes []Scope, expiresAt *time.Time) (*Token, string, error)
+	GetByPlaintext(ctx context.Context, plaintext string) (*Token, error)
+	ListByUserID(ctx context.Context, userID uuid.UUID) ([]Token, error)
+	Revoke(ctx context.Context, userID uuid.UUID, tokenID uuid.UUID) error
+	RevokeAll(ctx context.Context, userID uuid.UUID) error
+	TouchLastUsed(ctx context.Context, tokenID uuid.UUID) error
+}
@@ -0,0 +1,119 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/billbatista/acasinha-expenses/eventlogger"
+	"github.com/google/uuid"
+)
+
+// Activity is one thing a user did, projected from the events they caused
+type Activity struct {
+	EventID   uuid.UUID      `json:"event_id"`
+	UserID    uuid.UUID      `json:"user_id"`
+	EventType string         `json:"event_type"`
+	LedgerID  *uuid.UUID     `json:"ledger_id"`
+	Data      map[string]any `json:"data"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+type activityProjection struct{}
+
+// NewActivityProjection records every event but health checks under the user
+// who caused it: the user_id in the request metadata, or the one in the
+// event data
+func NewActivityProjection() eventlogger.Projection {
+	return activityProjection{}
+}
+
+func (activityProjection) Name() string {
+	return "user_activity"
+}
+
+func (activityProjection) Types() []string {
+	return nil
+}
+
+func (activityProjection) Apply(ctx context.Context, tx *sql.Tx, e eventlogger.Event) error {
+	if e.Type == (eventlogger.HealthRequested{}).EventType() {
+		return nil
+	}
+
+	var data struct {
+		UserID   string `json:"user_id"`
+		LedgerID string `json:"ledger_id"`
+	}
+	if err := e.DecodeData(&data); err != nil {
+		// not an object, so there's no user to attribute it to
+		return nil
+	}
+
+	actor := e.Metadata[eventlogger.MetadataUserID]
+	if actor == "" {
+		actor = data.UserID
+	}
+	userID, err := uuid.Parse(actor)
+	if err != nil {
+		return nil
+	}
+
+	var ledgerID *uuid.UUID
+	if id, err := uuid.Parse(data.LedgerID); err == nil {
+		ledgerID = &id
+	}
+
+	jsonData, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO user_activity (event_id, user_id, event_type, ledger_id, event_data, created_at) 
+              VALUES ($1, $2, $3, $4, $5, $6) 
+              ON CONFLICT (event_id) DO NOTHING`
+	_, err = tx.ExecContext(ctx, query, e.ID, userID, e.Type, ledgerID, jsonData, e.CreatedAt)
+	return err
+}
+
+func (activityProjection) Reset(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM user_activity`)
+	return err
+}
+
+// GetActivity returns the user's activity, newest first
+func (r *repository) GetActivity(ctx context.Context, userID uuid.UUID, limit, offset int) ([]Activity, error) {
+	query := `SELECT event_id, user_id, event_type, ledger_id, event_data, created_at 
+              FROM user_activity 
+              WHERE user_id = $1 
+              ORDER BY created_at DESC, event_id DESC 
+              LIMIT $2 OFFSET $3`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activity []Activity
+	for rows.Next() {
+		var a Activity
+		var ledgerID uuid.NullUUID
+		var jsonData []byte
+		if err := rows.Scan(&a.EventID, &a.UserID, &a.EventType, &ledgerID, &jsonData, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		if ledgerID.Valid {
+			a.LedgerID = &ledgerID.UUID
+		}
+		if len(jsonData) > 0 {
+			if err := json.Unmarshal(jsonData, &a.Data); err != nil {
+				return nil, err
+			}
+		}
+		activity = append(activity, a)
+	}
+
+	return activity, rows.Err()
+}
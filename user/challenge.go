@@ -0,0 +1,101 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidLoginChallenge = errors.New("login expired, enter your email and password again")
+
+const (
+	loginChallengeDuration = 5 * time.Minute
+	maxChallengeAttempts   = 5
+)
+
+// CreateLoginChallenge records that the user got the password right and
+// still has to give a 2FA code. It returns the challenge token in
+// plaintext, to be kept in a cookie until the code comes in.
+func (r *repository) CreateLoginChallenge(ctx context.Context, userID uuid.UUID) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	plaintext := base64.RawURLEncoding.EncodeToString(b)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	// only the latest login attempt can be completed
+	_, err = tx.ExecContext(ctx, `DELETE FROM login_challenges WHERE user_id = $1 OR expires_at < NOW()`, userID)
+	if err != nil {
+		return "", err
+	}
+
+	query := `INSERT INTO login_challenges (id, user_id, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4, $5)`
+	now := time.Now().UTC()
+	_, err = tx.ExecContext(ctx, query, uuid.New(), userID, hashToken(plaintext), now.Add(loginChallengeDuration), now)
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, tx.Commit()
+}
+
+// LoginChallengeUser returns the user behind a challenge that can still be
+// completed, so failed codes can be counted against their account
+func (r *repository) LoginChallengeUser(ctx context.Context, plaintext string) (*User, error) {
+	query := `SELECT user_id FROM login_challenges WHERE token_hash = $1 AND expires_at > NOW() AND attempts < $2`
+	var userID uuid.UUID
+	err := r.db.QueryRowContext(ctx, query, hashToken(plaintext), maxChallengeAttempts).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidLoginChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := r.GetByID(ctx, userID)
+	if err == nil && u == nil {
+		return nil, ErrInvalidLoginChallenge
+	}
+	return u, err
+}
+
+// CompleteLoginChallenge checks the 2FA code for the user behind the
+// challenge and returns them. The challenge is used up on success, and
+// stops working after too many wrong codes. It also reports whether a
+// recovery code was used.
+func (r *repository) CompleteLoginChallenge(ctx context.Context, plaintext, code string) (*User, bool, error) {
+	query := `UPDATE login_challenges SET attempts = attempts + 1
+              WHERE token_hash = $1 AND expires_at > NOW() AND attempts < $2
+              RETURNING id, user_id`
+	var challengeID, userID uuid.UUID
+	err := r.db.QueryRowContext(ctx, query, hashToken(plaintext), maxChallengeAttempts).Scan(&challengeID, &userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, ErrInvalidLoginChallenge
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	usedRecoveryCode, err := r.VerifyTwoFactor(ctx, userID, code)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM login_challenges WHERE id = $1`, challengeID); err != nil {
+		return nil, false, err
+	}
+
+	u, err := r.GetByID(ctx, userID)
+	return u, usedRecoveryCode, err
+}
@@ -0,0 +1,158 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrEmailNotVerified         = errors.New("email address not verified yet")
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification link")
+	ErrSameEmail                = errors.New("that's already your email")
+)
+
+const verificationTokenDuration = 24 * time.Hour
+
+// NormalizeEmail parses a bare RFC 5322 address, without a display name,
+// and returns it trimmed and lowercased. That's the form stored and looked
+// up, so "Foo@X.com " and "foo@x.com" are the same account.
+func NormalizeEmail(raw string) (string, error) {
+	trimmed := strings.TrimSpace(raw)
+	addr, err := mail.ParseAddress(trimmed)
+	if err != nil || addr.Name != "" || addr.Address != trimmed {
+		return "", ErrInvalidEmail
+	}
+	if _, domain, _ := strings.Cut(addr.Address, "@"); domain == "" {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(addr.Address), nil
+}
+
+// IsVerified reports whether the user confirmed they own their email
+func (u *User) IsVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// CreateEmailVerification issues a token proving the user owns email and
+// returns it in plaintext, to be emailed. The token only verifies that
+// address, so it's useless once the user changes email.
+func (r *repository) CreateEmailVerification(ctx context.Context, userID uuid.UUID, email string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	plaintext := base64.RawURLEncoding.EncodeToString(b)
+
+	query := `INSERT INTO email_verification_tokens (id, user_id, email, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	now := time.Now().UTC()
+	_, err := r.db.ExecContext(ctx, query, uuid.New(), userID, email, hashToken(plaintext), now.Add(verificationTokenDuration), now)
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// VerifyEmail marks the address the token was issued for as verified and
+// uses the token up
+func (r *repository) VerifyEmail(ctx context.Context, plaintext string) (*User, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT id, user_id, email FROM email_verification_tokens 
+              WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() 
+              FOR UPDATE`
+	var tokenID, userID uuid.UUID
+	var email string
+	err = tx.QueryRowContext(ctx, query, hashToken(plaintext)).Scan(&tokenID, &userID, &email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1 AND email = $2`, userID, email)
+	if err != nil {
+		return nil, err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		// the user changed email since
+		return nil, ErrInvalidVerificationToken
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE email_verification_tokens SET used_at = NOW() WHERE id = $1`, tokenID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return r.GetByID(ctx, userID)
+}
+
+// ChangeEmail moves the account to a new address once the current password
+// is confirmed. The new address starts out unverified, and reset links
+// sent to the old one stop working. The current password is checked before
+// anything else, so any other error means it was right.
+func (r *repository) ChangeEmail(ctx context.Context, userID uuid.UUID, currentPassword, newEmail string) (*User, error) {
+	u, err := r.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, fmt.Errorf("user %s not found", userID)
+	}
+
+	if err := r.VerifyPassword(u.PasswordHash, currentPassword); err != nil {
+		return nil, ErrWrongPassword
+	}
+
+	newEmail, err = NormalizeEmail(newEmail)
+	if err != nil {
+		return nil, err
+	}
+	if newEmail == u.Email {
+		return nil, ErrSameEmail
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET email = $1, email_verified_at = NULL WHERE id = $2`, newEmail, userID)
+	if err != nil {
+		err = constraints.Translate(err)
+		if errors.Is(err, ErrEmailExists) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("updating email: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM password_reset_tokens WHERE user_id = $1 AND used_at IS NULL`, userID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return r.GetByID(ctx, userID)
+}
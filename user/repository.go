@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/billbatista/acasinha-expenses/dberr"
+	"github.com/billbatista/acasinha-expenses/password"
+	"github.com/billbatista/acasinha-expenses/token"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -15,26 +18,58 @@ var (
 	ErrEmailExists   = errors.New("email already exists")
 	ErrInvalidEmail  = errors.New("invalid email format")
 	ErrBlankPassword = errors.New("password can't be blank")
+	ErrWrongPassword = errors.New("current password is incorrect")
+	ErrSamePassword  = errors.New("new password must be different from the current one")
 )
 
+// constraints maps the users table constraints to their domain errors
+var constraints = dberr.Constraints{
+	"users_email_key":            ErrEmailExists,
+	"users_email_normalized_key": ErrEmailExists,
+}
+
 type repository struct {
-	db *sql.DB
+	db     *sql.DB
+	policy password.Policy
 }
 
-func NewRepository(db *sql.DB) *repository {
-	return &repository{db: db}
+type Option func(*repository)
+
+// WithPasswordPolicy sets the policy new passwords are checked against,
+// password.DefaultPolicy by default
+func WithPasswordPolicy(policy password.Policy) Option {
+	return func(r *repository) {
+		r.policy = policy
+	}
 }
 
-func (r *repository) Register(ctx context.Context, email, password string) (*User, error) {
-	if email == "" {
-		return nil, ErrInvalidEmail
+func NewRepository(db *sql.DB, opts ...Option) *repository {
+	r := &repository{db: db, policy: password.DefaultPolicy()}
+	for _, opt := range opts {
+		opt(r)
 	}
+	return r
+}
 
-	if password == "" {
-		return nil, ErrBlankPassword
+// checkPassword validates a new password for the user with this email
+func (r *repository) checkPassword(newPassword, email string) error {
+	if newPassword == "" {
+		return ErrBlankPassword
 	}
+	return r.policy.Check(newPassword, email)
+}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+func (r *repository) Register(ctx context.Context, email, plainPassword string) (*User, error) {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.checkPassword(plainPassword, email); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(plainPassword), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, fmt.Errorf("hashing password: %w", err)
 	}
@@ -49,23 +84,35 @@ func (r *repository) Register(ctx context.Context, email, password string) (*Use
 	query := `INSERT INTO users (id, email, password_hash, created_at) VALUES ($1, $2, $3, $4)`
 	_, err = r.db.ExecContext(ctx, query, user.ID, user.Email, user.PasswordHash, user.CreatedAt)
 	if err != nil {
-		// check for unique constraint error
-		// return nil, ErrEmailExists
+		err = constraints.Translate(err)
+		if errors.Is(err, ErrEmailExists) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("inserting user: %w", err)
 	}
 
 	return user, nil
 }
 
+// GetByEmail looks the user up by normalized email, returning nil for
+// addresses that aren't valid
 func (r *repository) GetByEmail(ctx context.Context, email string) (*User, error) {
-	query := `SELECT id, COALESCE(name, ''), email, password_hash, created_at, avatar FROM users WHERE email = $1`
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, nil
+	}
+
+	query := `SELECT id, COALESCE(name, ''), email, password_hash, is_admin, email_verified_at, totp_enabled_at, created_at, avatar FROM users WHERE lower(btrim(email)) = $1`
 
 	var user User
-	err := r.db.QueryRowContext(ctx, query, email).Scan(
+	err = r.db.QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
 		&user.Name,
 		&user.Email,
 		&user.PasswordHash,
+		&user.IsAdmin,
+		&user.EmailVerifiedAt,
+		&user.TwoFactorEnabledAt,
 		&user.CreatedAt,
 		&user.Avatar,
 	)
@@ -80,7 +127,7 @@ func (r *repository) GetByEmail(ctx context.Context, email string) (*User, error
 }
 
 func (r *repository) GetByID(ctx context.Context, id uuid.UUID) (*User, error) {
-	query := `SELECT id, COALESCE(name, ''), email, password_hash, created_at, avatar FROM users WHERE id = $1`
+	query := `SELECT id, COALESCE(name, ''), email, password_hash, is_admin, email_verified_at, totp_enabled_at, created_at, avatar FROM users WHERE id = $1`
 
 	var user User
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
@@ -88,6 +135,9 @@ func (r *repository) GetByID(ctx context.Context, id uuid.UUID) (*User, error) {
 		&user.Name,
 		&user.Email,
 		&user.PasswordHash,
+		&user.IsAdmin,
+		&user.EmailVerifiedAt,
+		&user.TwoFactorEnabledAt,
 		&user.CreatedAt,
 		&user.Avatar,
 	)
@@ -111,6 +161,49 @@ func (r *repository) VerifyPassword(hashedPassword, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
 
+// ChangePassword replaces the password once the current one is confirmed,
+// and revokes the user's access tokens. The current password is checked
+// before anything else, so any other error means it was right.
+func (r *repository) ChangePassword(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string) error {
+	u, err := r.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		return fmt.Errorf("user %s not found", userID)
+	}
+
+	if err := r.VerifyPassword(u.PasswordHash, currentPassword); err != nil {
+		return ErrWrongPassword
+	}
+	if newPassword == currentPassword {
+		return ErrSamePassword
+	}
+	if err := r.checkPassword(newPassword, u.Email); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("hashing password: %w", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2`, string(hashedPassword), userID); err != nil {
+		return err
+	}
+	if err := token.RevokeAllInTx(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (r *repository) UpdateAvatar(ctx context.Context, img []byte, userId uuid.UUID) error {
 	query := `UPDATE users SET avatar = $1 WHERE id = $2`
 	_, err := r.db.ExecContext(ctx, query, img, userId)
@@ -0,0 +1,114 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/billbatista/acasinha-expenses/token"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset link")
+
+const resetTokenDuration = time.Hour
+
+// CreatePasswordReset issues a reset token for the user and returns it in
+// plaintext, to be emailed; only its hash is stored. Earlier unused tokens
+// stop working.
+func (r *repository) CreatePasswordReset(ctx context.Context, userID uuid.UUID) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	plaintext := base64.RawURLEncoding.EncodeToString(b)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM password_reset_tokens WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		return "", err
+	}
+
+	query := `INSERT INTO password_reset_tokens (id, user_id, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4, $5)`
+	now := time.Now().UTC()
+	_, err = tx.ExecContext(ctx, query, uuid.New(), userID, hashToken(plaintext), now.Add(resetTokenDuration), now)
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, tx.Commit()
+}
+
+// ResetPassword sets a new password with a reset token and uses the token
+// up, returning the user whose password changed. Their access tokens are
+// revoked with it, the reset may be to take the account back.
+func (r *repository) ResetPassword(ctx context.Context, plaintext, newPassword string) (*User, error) {
+	if newPassword == "" {
+		return nil, ErrBlankPassword
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT t.user_id, u.email FROM password_reset_tokens t 
+              JOIN users u ON u.id = t.user_id 
+              WHERE t.token_hash = $1 AND t.used_at IS NULL AND t.expires_at > NOW() 
+              FOR UPDATE OF t`
+	var userID uuid.UUID
+	var email string
+	err = tx.QueryRowContext(ctx, query, hashToken(plaintext)).Scan(&userID, &email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidResetToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// checked only once the token is known good, so a bad link isn't
+	// reported as a weak password
+	if err := r.checkPassword(newPassword, email); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("hashing password: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2`, string(hashedPassword), userID); err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := token.RevokeAllInTx(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return r.GetByID(ctx, userID)
+}
+
+func hashToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,252 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/billbatista/acasinha-expenses/totp"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already on")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is off")
+	ErrInvalidTwoFactorCode = errors.New("invalid authentication code")
+)
+
+const (
+	recoveryCodeCount = 10
+	recoveryCodeLen   = 10
+)
+
+// HasTwoFactor reports whether logging in also takes a TOTP code
+func (u *User) HasTwoFactor() bool {
+	return u.TwoFactorEnabledAt != nil
+}
+
+// BeginTwoFactor returns the TOTP secret to enroll, generating it the first
+// time, so reloading the setup page keeps showing the same QR code
+func (r *repository) BeginTwoFactor(ctx context.Context, userID uuid.UUID) (string, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+
+	query := `UPDATE users SET totp_secret = COALESCE(totp_secret, $1)
+              WHERE id = $2 AND totp_enabled_at IS NULL
+              RETURNING totp_secret`
+	err = r.db.QueryRowContext(ctx, query, secret, userID).Scan(&secret)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrTwoFactorEnabled
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// EnableTwoFactor turns 2FA on once the user proves their authenticator
+// app has the secret, and returns the recovery codes in plaintext, to be
+// shown once
+func (r *repository) EnableTwoFactor(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	secret, enabledAt, lastStep, err := lockTwoFactor(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabledAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+	if !secret.Valid {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	step, err := totp.Validate(secret.String, code, time.Now(), lastStep)
+	if err != nil {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET totp_enabled_at = NOW(), totp_last_step = $1 WHERE id = $2`, step, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, tx.Commit()
+}
+
+// DisableTwoFactor turns 2FA off once the current password is confirmed,
+// discarding the secret and recovery codes
+func (r *repository) DisableTwoFactor(ctx context.Context, userID uuid.UUID, currentPassword string) error {
+	u, err := r.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		return fmt.Errorf("user %s not found", userID)
+	}
+	if err := r.VerifyPassword(u.PasswordHash, currentPassword); err != nil {
+		return ErrWrongPassword
+	}
+	if !u.HasTwoFactor() {
+		return ErrTwoFactorNotEnabled
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM login_challenges WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// VerifyTwoFactor checks a TOTP code, or else a recovery code, for the
+// user, using it up. It reports whether a recovery code was used.
+func (r *repository) VerifyTwoFactor(ctx context.Context, userID uuid.UUID, code string) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// the lock keeps two requests from both accepting the same code
+	secret, enabledAt, lastStep, err := lockTwoFactor(ctx, tx, userID)
+	if err != nil {
+		return false, err
+	}
+	if enabledAt == nil || !secret.Valid {
+		return false, ErrTwoFactorNotEnabled
+	}
+
+	if recovery, ok := normalizeRecoveryCode(code); ok {
+		query := `UPDATE user_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+		result, err := tx.ExecContext(ctx, query, userID, hashToken(recovery))
+		if err != nil {
+			return false, err
+		}
+		if affected, err := result.RowsAffected(); err != nil {
+			return false, err
+		} else if affected == 0 {
+			return false, ErrInvalidTwoFactorCode
+		}
+		return true, tx.Commit()
+	}
+
+	step, err := totp.Validate(secret.String, code, time.Now(), lastStep)
+	if err != nil {
+		return false, ErrInvalidTwoFactorCode
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET totp_last_step = $1 WHERE id = $2`, step, userID); err != nil {
+		return false, err
+	}
+
+	return false, tx.Commit()
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes, used or not, and
+// returns the new ones in plaintext
+func (r *repository) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, enabledAt, _, err := lockTwoFactor(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabledAt == nil {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, tx.Commit()
+}
+
+// RecoveryCodesLeft counts the recovery codes the user hasn't used yet
+func (r *repository) RecoveryCodesLeft(ctx context.Context, userID uuid.UUID) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+func lockTwoFactor(ctx context.Context, tx *sql.Tx, userID uuid.UUID) (sql.NullString, *time.Time, int64, error) {
+	var secret sql.NullString
+	var enabledAt *time.Time
+	var lastStep int64
+
+	query := `SELECT totp_secret, totp_enabled_at, totp_last_step FROM users WHERE id = $1 FOR UPDATE`
+	err := tx.QueryRowContext(ctx, query, userID).Scan(&secret, &enabledAt, &lastStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return secret, nil, 0, fmt.Errorf("user %s not found", userID)
+	}
+	return secret, enabledAt, lastStep, err
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID uuid.UUID) ([]string, error) {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		b := make([]byte, recoveryCodeLen)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:recoveryCodeLen]
+
+		query := `INSERT INTO user_recovery_codes (id, user_id, code_hash, created_at) VALUES ($1, $2, $3, $4)`
+		if _, err := tx.ExecContext(ctx, query, uuid.New(), userID, hashToken(code), time.Now().UTC()); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:recoveryCodeLen/2]+"-"+code[recoveryCodeLen/2:])
+	}
+
+	return codes, nil
+}
+
+// normalizeRecoveryCode strips the dash and spaces from what the user typed
+// and reports whether it has the shape of a recovery code, rather than a
+// TOTP code, which is all digits
+func normalizeRecoveryCode(input string) (string, bool) {
+	code := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(input)))
+	if len(code) != recoveryCodeLen {
+		return "", false
+	}
+	return code, true
+}
@@ -13,13 +13,35 @@ type User struct {
 	Email        string    `json:"email"`
 	Avatar       []byte    `json:"avatar"`
 	PasswordHash string    `json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
+	IsAdmin      bool      `json:"is_admin"`
+	// EmailVerifiedAt is nil until the user follows the verification link
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// TwoFactorEnabledAt is nil unless logging in also takes a TOTP code
+	TwoFactorEnabledAt *time.Time `json:"two_factor_enabled_at"`
+	CreatedAt          time.Time  `json:"created_at"`
 }
 
 type Repository interface {
 	Register(ctx context.Context, email, password string) (*User, error)
 	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*User, error)
 	VerifyPassword(hashedPassword, password string) error
 	UpdateName(ctx context.Context, userID uuid.UUID, name string) error
-	UpdateAvatar(ctx context.Context, img []byte) error
+	UpdateAvatar(ctx context.Context, img []byte, userId uuid.UUID) error
+	GetActivity(ctx context.Context, userID uuid.UUID, limit, offset int) ([]Activity, error)
+	CreatePasswordReset(ctx context.Context, userID uuid.UUID) (string, error)
+	ResetPassword(ctx context.Context, token, newPassword string) (*User, error)
+	CreateEmailVerification(ctx context.Context, userID uuid.UUID, email string) (string, error)
+	VerifyEmail(ctx context.Context, token string) (*User, error)
+	ChangePassword(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string) error
+	ChangeEmail(ctx context.Context, userID uuid.UUID, currentPassword, newEmail string) (*User, error)
+	BeginTwoFactor(ctx context.Context, userID uuid.UUID) (string, error)
+	EnableTwoFactor(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+	DisableTwoFactor(ctx context.Context, userID uuid.UUID, currentPassword string) error
+	VerifyTwoFactor(ctx context.Context, userID uuid.UUID, code string) (bool, error)
+	RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error)
+	RecoveryCodesLeft(ctx context.Context, userID uuid.UUID) (int, error)
+	CreateLoginChallenge(ctx context.Context, userID uuid.UUID) (string, error)
+	LoginChallengeUser(ctx context.Context, token string) (*User, error)
+	CompleteLoginChallenge(ctx context.Context, token, code string) (*User, bool, error)
 }
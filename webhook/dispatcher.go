@@ -0,0 +1,196 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type Dispatcher struct {
+	repo         Repository
+	client       *http.Client
+	pollInterval time.Duration
+	batchSize    int
+	maxAttempts  int
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+	wg           sync.WaitGroup
+	ctx          context.Context
+	cancel       context.CancelFunc
+}
+
+type DispatcherOption func(*Dispatcher)
+
+// WithHTTPClient replaces the default client, which refuses to connect to
+// anything but public addresses
+func WithHTTPClient(client *http.Client) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.client = client
+	}
+}
+
+func WithPollInterval(interval time.Duration) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.pollInterval = interval
+	}
+}
+
+// WithRetries sets how many attempts a delivery gets before it's marked dead,
+// and the first backoff, which doubles on every failure up to max
+func WithRetries(maxAttempts int, base time.Duration, max time.Duration) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.maxAttempts = maxAttempts
+		d.baseBackoff = base
+		d.maxBackoff = max
+	}
+}
+
+func NewDispatcher(repo Repository, opts ...DispatcherOption) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		repo:         repo,
+		client:       guardedClient(10 * time.Second),
+		pollInterval: 5 * time.Second,
+		batchSize:    20,
+		maxAttempts:  8,
+		baseBackoff:  30 * time.Second,
+		maxBackoff:   6 * time.Hour,
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+func (d *Dispatcher) Start() {
+	d.wg.Go(func() {
+		ticker := time.NewTicker(d.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-ticker.C:
+				d.DispatchDue(d.ctx)
+			}
+		}
+	})
+}
+
+func (d *Dispatcher) Shutdown() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+// DispatchDue sends every delivery that is due, returning how many were attempted
+func (d *Dispatcher) DispatchDue(ctx context.Context) int {
+	// the lease outlives the request timeout so a slow receiver isn't retried in parallel
+	due, err := d.repo.ClaimDue(ctx, d.batchSize, d.client.Timeout+time.Minute)
+	if err != nil {
+		slog.Error("failed to claim webhook deliveries", "error", err)
+		return 0
+	}
+
+	for _, delivery := range due {
+		d.deliver(ctx, delivery)
+	}
+
+	return len(due)
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery DueDelivery) {
+	status, err := d.send(ctx, delivery)
+	if err == nil {
+		if err := d.repo.MarkSucceeded(ctx, delivery.ID, status); err != nil {
+			slog.Error("failed to mark webhook delivery", "error", err, "delivery_id", delivery.ID)
+		}
+		return
+	}
+
+	attempts := delivery.Attempts + 1
+	nextStatus := StatusFailed
+	if attempts >= d.maxAttempts {
+		nextStatus = StatusDead
+	}
+
+	slog.Warn("webhook delivery failed",
+		"error", err,
+		"delivery_id", delivery.ID,
+		"attempts", attempts,
+		"status", nextStatus,
+	)
+
+	nextAttempt := time.Now().UTC().Add(d.backoff(attempts))
+	if err := d.repo.MarkFailed(ctx, delivery.ID, nextStatus, status, deliveryError(err), nextAttempt); err != nil {
+		slog.Error("failed to mark webhook delivery", "error", err, "delivery_id", delivery.ID)
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery DueDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, delivery.Payload))
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID.String())
+	req.Header.Set(EventIDHeader, delivery.EventID.String())
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errReceiverStatus(resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// errReceiverStatus is a receiver answering with something other than 2xx
+type errReceiverStatus int
+
+func (e errReceiverStatus) Error() string {
+	return fmt.Sprintf("receiver responded with %d", int(e))
+}
+
+// deliveryError is what members see of a failed delivery. Connection errors
+// name addresses and ports on our side of the network, so they only go to
+// the log.
+func deliveryError(err error) string {
+	var status errReceiverStatus
+	var netErr net.Error
+	switch {
+	case errors.As(err, &status):
+		return status.Error()
+	case errors.Is(err, ErrForbiddenTarget):
+		return ErrForbiddenTarget.Error()
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "receiver timed out"
+	default:
+		return "could not connect to receiver"
+	}
+}
+
+// backoff doubles the wait on each attempt: base, 2*base, 4*base... up to max
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.baseBackoff
+	for i := 1; i < attempts && wait < d.maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, d.maxBackoff)
+}
@@ -0,0 +1,233 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memoryRepository keeps deliveries in memory, claiming every due one
+type memoryRepository struct {
+	mu         sync.Mutex
+	deliveries map[uuid.UUID]*DueDelivery
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{deliveries: map[uuid.UUID]*DueDelivery{}}
+}
+
+func (m *memoryRepository) add(d DueDelivery) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries[d.ID] = &d
+}
+
+func (m *memoryRepository) get(id uuid.UUID) DueDelivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.deliveries[id]
+}
+
+func (m *memoryRepository) CreateSubscription(ctx context.Context, sub Subscription) error {
+	return nil
+}
+
+func (m *memoryRepository) DeleteSubscription(ctx context.Context, ledgerID uuid.UUID, subscriptionID uuid.UUID) error {
+	return nil
+}
+
+func (m *memoryRepository) GetSubscriptionsByLedger(ctx context.Context, ledgerID uuid.UUID) ([]Subscription, error) {
+	return nil, nil
+}
+
+func (m *memoryRepository) Enqueue(ctx context.Context, delivery Delivery) error {
+	return nil
+}
+
+func (m *memoryRepository) GetDeliveriesByLedger(ctx context.Context, ledgerID uuid.UUID, limit int) ([]Delivery, error) {
+	return nil, nil
+}
+
+func (m *memoryRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]DueDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []DueDelivery
+	for _, d := range m.deliveries {
+		if (d.Status == StatusPending || d.Status == StatusFailed) && len(due) < limit {
+			due = append(due, *d)
+		}
+	}
+	return due, nil
+}
+
+func (m *memoryRepository) MarkSucceeded(ctx context.Context, deliveryID uuid.UUID, responseStatus int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d := m.deliveries[deliveryID]
+	d.Status = StatusSucceeded
+	d.Attempts++
+	d.ResponseStatus = responseStatus
+	return nil
+}
+
+func (m *memoryRepository) MarkFailed(ctx context.Context, deliveryID uuid.UUID, status DeliveryStatus, responseStatus int, lastError string, nextAttemptAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d := m.deliveries[deliveryID]
+	d.Status = status
+	d.Attempts++
+	d.ResponseStatus = responseStatus
+	d.LastError = lastError
+	d.NextAttemptAt = nextAttemptAt
+	return nil
+}
+
+func (m *memoryRepository) Retry(ctx context.Context, ledgerID uuid.UUID, deliveryID uuid.UUID) error {
+	return nil
+}
+
+func newDelivery(url string) DueDelivery {
+	return DueDelivery{
+		Delivery: Delivery{
+			ID:        uuid.New(),
+			EventID:   uuid.New(),
+			EventType: "expense.created",
+			Payload:   []byte(`{"id":"1","type":"expense.created"}`),
+			Status:    StatusPending,
+		},
+		URL:    url,
+		Secret: "whsec_test",
+	}
+}
+
+func TestDispatcherSignsDeliveries(t *testing.T) {
+	type received struct {
+		body    []byte
+		headers http.Header
+	}
+	got := make(chan received, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{body: body, headers: r.Header.Clone()}
+	}))
+	defer receiver.Close()
+
+	repo := newMemoryRepository()
+	delivery := newDelivery(receiver.URL)
+	repo.add(delivery)
+
+	d := NewDispatcher(repo, WithHTTPClient(receiver.Client()))
+	if n := d.DispatchDue(context.Background()); n != 1 {
+		t.Fatalf("DispatchDue() = %d, want 1", n)
+	}
+
+	r := <-got
+	if !Verify(delivery.Secret, r.body, r.headers.Get(SignatureHeader)) {
+		t.Errorf("signature %q doesn't verify for body %s", r.headers.Get(SignatureHeader), r.body)
+	}
+	if Verify("whsec_other", r.body, r.headers.Get(SignatureHeader)) {
+		t.Error("signature verifies with another secret")
+	}
+	if h := r.headers.Get(EventIDHeader); h != delivery.EventID.String() {
+		t.Errorf("%s = %q, want %q", EventIDHeader, h, delivery.EventID)
+	}
+	if h := r.headers.Get(EventHeader); h != delivery.EventType {
+		t.Errorf("%s = %q, want %q", EventHeader, h, delivery.EventType)
+	}
+
+	if d := repo.get(delivery.ID); d.Status != StatusSucceeded || d.ResponseStatus != http.StatusOK {
+		t.Errorf("delivery is %s with response %d, want succeeded with 200", d.Status, d.ResponseStatus)
+	}
+}
+
+func TestDispatcherBacksOffUntilDead(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	repo := newMemoryRepository()
+	delivery := newDelivery(receiver.URL)
+	repo.add(delivery)
+
+	d := NewDispatcher(repo, WithHTTPClient(receiver.Client()), WithRetries(3, time.Minute, 90*time.Second))
+
+	wantBackoff := []time.Duration{time.Minute, 90 * time.Second, 90 * time.Second}
+	wantStatus := []DeliveryStatus{StatusFailed, StatusFailed, StatusDead}
+	for attempt := range wantStatus {
+		before := time.Now().UTC()
+		d.DispatchDue(context.Background())
+
+		got := repo.get(delivery.ID)
+		if got.Status != wantStatus[attempt] || got.Attempts != attempt+1 {
+			t.Fatalf("after attempt %d delivery is %s with %d attempts, want %s", attempt+1, got.Status, got.Attempts, wantStatus[attempt])
+		}
+		if got.ResponseStatus != http.StatusInternalServerError || got.LastError != "receiver responded with 500" {
+			t.Errorf("after attempt %d response is %d %q", attempt+1, got.ResponseStatus, got.LastError)
+		}
+		if wait := got.NextAttemptAt.Sub(before); wait < wantBackoff[attempt] || wait > wantBackoff[attempt]+time.Second {
+			t.Errorf("after attempt %d next attempt is in %s, want %s", attempt+1, wait, wantBackoff[attempt])
+		}
+	}
+
+	if n := d.DispatchDue(context.Background()); n != 0 {
+		t.Errorf("dead delivery was attempted again")
+	}
+}
+
+func TestDispatcherRefusesPrivateAddresses(t *testing.T) {
+	var called atomic.Bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+	}))
+	defer receiver.Close()
+
+	repo := newMemoryRepository()
+	delivery := newDelivery(receiver.URL)
+	repo.add(delivery)
+
+	NewDispatcher(repo).DispatchDue(context.Background())
+
+	if called.Load() {
+		t.Error("the default client connected to a loopback receiver")
+	}
+	if got := repo.get(delivery.ID); got.Status != StatusFailed || got.LastError != ErrForbiddenTarget.Error() {
+		t.Errorf("delivery is %s with %q, want failed with %q", got.Status, got.LastError, ErrForbiddenTarget)
+	}
+}
+
+func TestNewSubscriptionRejectsPrivateTargets(t *testing.T) {
+	for _, target := range []string{
+		"http://127.0.0.1/hook",
+		"http://localhost:8080/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+		"http://0.0.0.0/hook",
+	} {
+		_, err := NewSubscription(context.Background(), uuid.New(), target, "", "", uuid.New())
+		if err != ErrForbiddenTarget {
+			t.Errorf("NewSubscription(%q) = %v, want %v", target, err, ErrForbiddenTarget)
+		}
+	}
+
+	sub, err := NewSubscription(context.Background(), uuid.New(), "https://93.184.215.14/hook", "", "", uuid.New())
+	if err != nil {
+		t.Fatalf("NewSubscription() with a public address = %v", err)
+	}
+	if sub.Secret == "" {
+		t.Error("no secret generated")
+	}
+}
@@ -0,0 +1,133 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/billbatista/acasinha-expenses/eventlogger"
+	"github.com/google/uuid"
+)
+
+// logger decorates an EventLogger, queueing a delivery for every webhook
+// subscribed to the ledger the event belongs to
+type logger struct {
+	next eventlogger.EventLogger
+	repo Repository
+}
+
+func NewLogger(next eventlogger.EventLogger, repo Repository) *logger {
+	return &logger{next: next, repo: repo}
+}
+
+func (l *logger) Save(ctx context.Context, e eventlogger.Event) error {
+	if err := l.next.Save(ctx, e); err != nil {
+		return err
+	}
+
+	return l.enqueue(ctx, e)
+}
+
+func (l *logger) SaveBatch(ctx context.Context, events []eventlogger.Event) error {
+	if err := eventlogger.SaveAll(ctx, l.next, events); err != nil {
+		return err
+	}
+
+	for _, e := range events {
+		if err := l.enqueue(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueue queues a delivery for each subscription matching the event
+func (l *logger) enqueue(ctx context.Context, e eventlogger.Event) error {
+	ledgerID, ok := ledgerIDOf(e)
+	if !ok {
+		return nil
+	}
+
+	subs, err := l.repo.GetSubscriptionsByLedger(ctx, ledgerID)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	for _, sub := range subs {
+		if !sub.Matches(e.Type) {
+			continue
+		}
+
+		if payload == nil {
+			payload, err = json.Marshal(newPublicEvent(e))
+			if err != nil {
+				return err
+			}
+		}
+
+		now := time.Now().UTC()
+		err := l.repo.Enqueue(ctx, Delivery{
+			ID:             uuid.New(),
+			SubscriptionID: sub.ID,
+			EventID:        e.ID,
+			EventType:      e.Type,
+			Payload:        payload,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// publicEvent is what receivers get of an event. It's spelled out rather than
+// the event itself so the metadata, with the client IP, user agent and
+// session of whoever acted, stays with us; the keys are the ones the event
+// has always been encoded with.
+type publicEvent struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"event_type"`
+	Data      any       `json:"event_data,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newPublicEvent(e eventlogger.Event) publicEvent {
+	return publicEvent{
+		ID:        e.ID,
+		Type:      e.Type,
+		Data:      e.Data,
+		CreatedAt: e.CreatedAt,
+	}
+}
+
+func (l *logger) GetByType(ctx context.Context, eventType string) ([]eventlogger.Event, error) {
+	return l.next.GetByType(ctx, eventType)
+}
+
+// ledgerIDOf finds the ledger in the event metadata, falling back to the
+// ledger_id field of the event data
+func ledgerIDOf(e eventlogger.Event) (uuid.UUID, bool) {
+	if v, ok := e.Metadata[eventlogger.MetadataLedgerID]; ok {
+		id, err := uuid.Parse(v)
+		return id, err == nil
+	}
+
+	raw, err := json.Marshal(e.Data)
+	if err != nil {
+		return uuid.Nil, false
+	}
+
+	var data struct {
+		LedgerID string `json:"ledger_id"`
+	}
+	if err := json.Unmarshal(raw, &data); err != nil || data.LedgerID == "" {
+		return uuid.Nil, false
+	}
+
+	id, err := uuid.Parse(data.LedgerID)
+	return id, err == nil
+}
@@ -0,0 +1,251 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *repository {
+	return &repository{db: db}
+}
+
+func (r *repository) CreateSubscription(ctx context.Context, sub Subscription) error {
+	query := `INSERT INTO webhook_subscriptions (id, ledger_id, url, secret, event_types, created_by, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := r.db.ExecContext(
+		ctx,
+		query,
+		sub.ID,
+		sub.LedgerID,
+		sub.URL,
+		sub.Secret,
+		pq.Array(sub.EventTypes),
+		sub.CreatedBy,
+		sub.CreatedAt,
+	)
+	return err
+}
+
+func (r *repository) DeleteSubscription(ctx context.Context, ledgerID uuid.UUID, subscriptionID uuid.UUID) error {
+	query := `DELETE FROM webhook_subscriptions WHERE id = $1 AND ledger_id = $2`
+	result, err := r.db.ExecContext(ctx, query, subscriptionID, ledgerID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) GetSubscriptionsByLedger(ctx context.Context, ledgerID uuid.UUID) ([]Subscription, error) {
+	query := `SELECT id, ledger_id, url, secret, event_types, created_by, created_at 
+              FROM webhook_subscriptions 
+              WHERE ledger_id = $1 
+              ORDER BY created_at ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, ledgerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []Subscription
+	for rows.Next() {
+		var sub Subscription
+		err := rows.Scan(
+			&sub.ID,
+			&sub.LedgerID,
+			&sub.URL,
+			&sub.Secret,
+			pq.Array(&sub.EventTypes),
+			&sub.CreatedBy,
+			&sub.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+// Enqueue stores a pending delivery. Enqueuing the same event twice for a
+// subscription is a no-op, so events delivered at least once stay unique.
+func (r *repository) Enqueue(ctx context.Context, delivery Delivery) error {
+	query := `
+        INSERT INTO webhook_deliveries (id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, 0, $7, $8)
+        ON CONFLICT (subscription_id, event_id) DO NOTHING
+    `
+	_, err := r.db.ExecContext(
+		ctx,
+		query,
+		delivery.ID,
+		delivery.SubscriptionID,
+		delivery.EventID,
+		delivery.EventType,
+		delivery.Payload,
+		StatusPending,
+		delivery.NextAttemptAt,
+		delivery.CreatedAt,
+	)
+	return err
+}
+
+func (r *repository) GetDeliveriesByLedger(ctx context.Context, ledgerID uuid.UUID, limit int) ([]Delivery, error) {
+	query := `SELECT d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at, 
+                     COALESCE(d.last_error, ''), COALESCE(d.response_status, 0), d.created_at, d.delivered_at
+              FROM webhook_deliveries d
+              INNER JOIN webhook_subscriptions s ON d.subscription_id = s.id
+              WHERE s.ledger_id = $1
+              ORDER BY d.created_at DESC
+              LIMIT $2`
+
+	rows, err := r.db.QueryContext(ctx, query, ledgerID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []Delivery
+	for rows.Next() {
+		var d Delivery
+		err := rows.Scan(
+			&d.ID,
+			&d.SubscriptionID,
+			&d.EventID,
+			&d.EventType,
+			&d.Payload,
+			&d.Status,
+			&d.Attempts,
+			&d.NextAttemptAt,
+			&d.LastError,
+			&d.ResponseStatus,
+			&d.CreatedAt,
+			&d.DeliveredAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// ClaimDue picks deliveries ready to be sent and pushes their next attempt
+// forward by lease, so concurrent dispatchers don't send them twice
+func (r *repository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]DueDelivery, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at, d.created_at, s.url, s.secret
+              FROM webhook_deliveries d
+              INNER JOIN webhook_subscriptions s ON d.subscription_id = s.id
+              WHERE d.status IN ($1, $2) AND d.next_attempt_at <= $3
+              ORDER BY d.next_attempt_at ASC
+              LIMIT $4
+              FOR UPDATE OF d SKIP LOCKED`
+
+	now := time.Now().UTC()
+	rows, err := tx.QueryContext(ctx, query, StatusPending, StatusFailed, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []DueDelivery
+	var ids []uuid.UUID
+	for rows.Next() {
+		var d DueDelivery
+		err := rows.Scan(
+			&d.ID,
+			&d.SubscriptionID,
+			&d.EventID,
+			&d.EventType,
+			&d.Payload,
+			&d.Status,
+			&d.Attempts,
+			&d.NextAttemptAt,
+			&d.CreatedAt,
+			&d.URL,
+			&d.Secret,
+		)
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, d)
+		ids = append(ids, d.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	update := `UPDATE webhook_deliveries SET next_attempt_at = $1 WHERE id = ANY($2)`
+	_, err = tx.ExecContext(ctx, update, now.Add(lease), pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	return due, tx.Commit()
+}
+
+func (r *repository) MarkSucceeded(ctx context.Context, deliveryID uuid.UUID, responseStatus int) error {
+	query := `UPDATE webhook_deliveries 
+              SET status = $1, attempts = attempts + 1, response_status = $2, last_error = NULL, delivered_at = $3 
+              WHERE id = $4`
+	_, err := r.db.ExecContext(ctx, query, StatusSucceeded, responseStatus, time.Now().UTC(), deliveryID)
+	return err
+}
+
+func (r *repository) MarkFailed(ctx context.Context, deliveryID uuid.UUID, status DeliveryStatus, responseStatus int, lastError string, nextAttemptAt time.Time) error {
+	query := `UPDATE webhook_deliveries 
+              SET status = $1, attempts = attempts + 1, response_status = NULLIF($2, 0), last_error = $3, next_attempt_at = $4 
+              WHERE id = $5`
+	_, err := r.db.ExecContext(ctx, query, status, responseStatus, lastError, nextAttemptAt, deliveryID)
+	return err
+}
+
+// Retry puts a dead delivery back in the queue with a fresh set of attempts
+func (r *repository) Retry(ctx context.Context, ledgerID uuid.UUID, deliveryID uuid.UUID) error {
+	query := `UPDATE webhook_deliveries d 
+              SET status = $1, attempts = 0, next_attempt_at = $2 
+              FROM webhook_subscriptions s 
+              WHERE d.subscription_id = s.id AND s.ledger_id = $3 AND d.id = $4 AND d.status = $5`
+	result, err := r.db.ExecContext(ctx, query, StatusPending, time.Now().UTC(), ledgerID, deliveryID, StatusDead)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
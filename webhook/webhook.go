@@ -0,0 +1,157 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidURL = errors.New("webhook url must be an absolute http or https url")
+	ErrNotFound   = errors.New("webhook not found")
+)
+
+type DeliveryStatus string
+
+const (
+	StatusPending   DeliveryStatus = "pending"
+	StatusSucceeded DeliveryStatus = "succeeded"
+	StatusFailed    DeliveryStatus = "failed"
+	// StatusDead means every retry failed and the delivery won't be attempted again
+	StatusDead DeliveryStatus = "dead"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	// EventIDHeader stays the same across retries, receivers can use it to drop duplicates
+	EventIDHeader = "X-Webhook-Event-Id"
+)
+
+type Subscription struct {
+	ID         uuid.UUID
+	LedgerID   uuid.UUID
+	URL        string
+	Secret     string
+	EventTypes []string
+	CreatedBy  uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Delivery struct {
+	ID             uuid.UUID
+	SubscriptionID uuid.UUID
+	EventID        uuid.UUID
+	EventType      string
+	Payload        []byte
+	Status         DeliveryStatus
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastError      string
+	ResponseStatus int
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+}
+
+type Repository interface {
+	CreateSubscription(ctx context.Context, sub Subscription) error
+	DeleteSubscription(ctx context.Context, ledgerID uuid.UUID, subscriptionID uuid.UUID) error
+	GetSubscriptionsByLedger(ctx context.Context, ledgerID uuid.UUID) ([]Subscription, error)
+	Enqueue(ctx context.Context, delivery Delivery) error
+	GetDeliveriesByLedger(ctx context.Context, ledgerID uuid.UUID, limit int) ([]Delivery, error)
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]DueDelivery, error)
+	MarkSucceeded(ctx context.Context, deliveryID uuid.UUID, responseStatus int) error
+	MarkFailed(ctx context.Context, deliveryID uuid.UUID, status DeliveryStatus, responseStatus int, lastError string, nextAttemptAt time.Time) error
+	Retry(ctx context.Context, ledgerID uuid.UUID, deliveryID uuid.UUID) error
+}
+
+// DueDelivery is a delivery ready to be sent, along with where to send it
+type DueDelivery struct {
+	Delivery
+	URL    string
+	Secret string
+}
+
+// NewSubscription validates the target URL, which must resolve to public
+// addresses only, and generates a secret when none is given. eventTypes is a
+// comma separated list; empty means every event.
+func NewSubscription(ctx context.Context, ledgerID uuid.UUID, rawURL string, secret string, eventTypes string, createdBy uuid.UUID) (Subscription, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return Subscription{}, ErrInvalidURL
+	}
+	if err := checkHost(ctx, u.Hostname()); err != nil {
+		return Subscription{}, err
+	}
+
+	if secret == "" {
+		secret, err = generateSecret()
+		if err != nil {
+			return Subscription{}, err
+		}
+	}
+
+	var types []string
+	for t := range strings.SplitSeq(eventTypes, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+
+	return Subscription{
+		ID:         uuid.New(),
+		LedgerID:   ledgerID,
+		URL:        u.String(),
+		Secret:     secret,
+		EventTypes: types,
+		CreatedBy:  createdBy,
+		CreatedAt:  time.Now().UTC(),
+	}, nil
+}
+
+// Matches reports whether the subscription wants the event type. Filters
+// ending in ".*" match by prefix, e.g. "ledger.*".
+func (s Subscription) Matches(eventType string) bool {
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, filter := range s.EventTypes {
+		if filter == eventType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(filter, "*"); ok && strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the signature header value for the payload
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header value in constant time, for receivers
+func Verify(secret string, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, payload)), []byte(signature))
+}
+
+func generateSecret() (string, error) {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}